@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// How division problems that don't come out clean are answered.
+const (
+	//DivisionInteger truncates toward zero: 22 / 7 is 3
+	DivisionInteger = "integer"
+	//DivisionRemainder gives the quotient and remainder: 22 / 7 is 3r1
+	DivisionRemainder = "remainder"
+	//DivisionDecimal rounds to DecimalPlaces, dropping trailing zeros: 22 / 7
+	//to two places is 3.14
+	DivisionDecimal = "decimal"
+)
+
+// maxDecimalPlaces keeps decimal answers short enough to type.
+const maxDecimalPlaces = 6
+
+var ErrOverflow = errors.New("answer overflows int")
+var ErrDivisionByZero = errors.New("division by zero")
+var ErrNegativeRoot = errors.New("square root of a negative number")
+var ErrNegativeExponent = errors.New("negative exponent")
+
+// Answer evaluates the problem with exact integer arithmetic, using its
+// operation's Answer.
+func (problem Problem) Answer() (int, error) {
+	if problem.IsChain() {
+		return problem.chainAnswer()
+	}
+	op := lookupOperation(problem.Operation)
+	if op == nil {
+		return 0, fmt.Errorf("unknown operation %q", problem.Operation)
+	}
+	return op.Answer(problem)
+}
+
+// chainAnswer works out a chained expression one step at a time, each step
+// checked like a two operand problem.
+func (problem Problem) chainAnswer() (int, error) {
+	apply := func(a int, operation string, b int) (int, error) {
+		return Problem{FirstNum: a, Operation: operation, SecondNum: b}.Answer()
+	}
+	links := problem.links()
+	if problem.Sequential {
+		res := links[0].Num
+		for _, link := range links[1:] {
+			var err error
+			res, err = apply(res, link.Operation, link.Num)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return res, nil
+	}
+
+	//terms of products and quotients are finished before being added to or
+	//subtracted from the sum
+	sum, pending, term := 0, "+", links[0].Num
+	for _, link := range links[1:] {
+		var err error
+		if link.Operation == "*" || link.Operation == "/" {
+			term, err = apply(term, link.Operation, link.Num)
+		} else {
+			sum, err = apply(sum, pending, term)
+			pending, term = link.Operation, link.Num
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return apply(sum, pending, term)
+}
+
+func checkedMul(a int, b int) (int, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	if (a == -1 && b == math.MinInt) || (b == -1 && a == math.MinInt) {
+		return 0, ErrOverflow
+	}
+	res := a * b
+	if res/b != a {
+		return 0, ErrOverflow
+	}
+	return res, nil
+}
+
+func checkedPow(base int, exponent int) (int, error) {
+	if exponent < 0 {
+		return 0, ErrNegativeExponent
+	}
+	res := 1
+	for i := 0; i < exponent; i++ {
+		//0, 1 and -1 never overflow, so huge exponents needn't be walked
+		if base == 0 || base == 1 {
+			return base, nil
+		}
+		if base == -1 {
+			return 1 - 2*(exponent%2), nil
+		}
+		var err error
+		res, err = checkedMul(res, base)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return res, nil
+}
+
+// intRoot is the largest integer whose nth power is at most a, for a >= 0.
+// Roots of perfect powers come out exact; others are truncated.
+func intRoot(a int, n int) int {
+	root := int(math.Pow(float64(a), 1/float64(n)))
+	//the float estimate can be off by one either way near large powers
+	for root > 0 {
+		power, err := checkedPow(root, n)
+		if err == nil && power <= a {
+			break
+		}
+		root--
+	}
+	for {
+		power, err := checkedPow(root+1, n)
+		if err != nil || power > a {
+			return root
+		}
+		root++
+	}
+}
+
+func getProblemAnswer(problem Problem) int {
+	ans, err := problem.Answer()
+	if err != nil {
+		fmt.Printf("Error evaluating %s\r\n", problem)
+		panic(err)
+	}
+	return ans
+}
+
+// ExpectedAnswer is the answer the player has to type for problem. It only
+// differs from Answer for uneven divisions, which are answered in the
+// config's division answer mode.
+func (config Config) ExpectedAnswer(problem Problem) (string, error) {
+	ans, err := problem.Answer()
+	if err != nil {
+		return "", err
+	}
+	if problem.Kind() != "/" || problem.FirstNum%problem.SecondNum == 0 {
+		return strconv.Itoa(ans), nil
+	}
+	switch config.DivisionConfig.AnswerMode {
+	case DivisionRemainder:
+		return fmt.Sprintf("%dr%d", ans, problem.FirstNum%problem.SecondNum), nil
+	case DivisionDecimal:
+		//big.Rat rounds halves away from zero on the exact quotient, where
+		//formatting a float64 would round its binary approximation
+		res := big.NewRat(int64(problem.FirstNum), int64(problem.SecondNum)).FloatString(config.DivisionConfig.DecimalPlaces)
+		if strings.Contains(res, ".") {
+			res = strings.TrimRight(strings.TrimRight(res, "0"), ".")
+		}
+		return res, nil
+	}
+	return strconv.Itoa(ans), nil
+}
+
+// answerHint tells the player what form the answer to problem takes, or is
+// empty when it's a plain integer.
+func (config Config) answerHint(problem Problem) string {
+	if problem.Kind() != "/" {
+		return ""
+	}
+	switch config.DivisionConfig.AnswerMode {
+	case DivisionRemainder:
+		return "(with remainder, like 3r1)"
+	case DivisionDecimal:
+		return fmt.Sprintf("(to %d decimal places)", config.DivisionConfig.DecimalPlaces)
+	}
+	return ""
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// OpChain is the operation that enables chained expressions like
+// 12 + 7 * 3 - 5.
+const OpChain = "chain"
+
+// chainOperations are the operations a chain can be built from.
+var chainOperations = []string{"+", "-", "*", "/"}
+
+const (
+	minChainLength = 3
+	maxChainLength = 6
+	//maxChainNumber bounds chain operands and answers, which keeps the
+	//arithmetic of picking the last operand clear of overflow
+	maxChainNumber = 1_000_000
+	//maxDivisorAttempts bounds how many divisors are tried for each division
+	//before the last
+	maxDivisorAttempts = 20
+	//maxDivisorScan bounds how many operands are checked as the divisor of
+	//the last division
+	maxDivisorScan = 10_000
+	//chainSamples is how many chains validation tries to estimate how often
+	//one comes out in range
+	chainSamples = 1000
+	//minChainSuccessRate is the share of tried chains that must come out in
+	//range, so generating one takes a handful of tries at worst
+	minChainSuccessRate = 0.05
+)
+
+// ChainConfig ranges chained expressions. Every operand is drawn from the
+// operand range, divisions always come out clean and the answer lands in the
+// answer range.
+type ChainConfig struct {
+	//Length is how many operands each chain has
+	Length     int
+	Operations []string
+	//Sequential chains are worked left to right, ignoring the usual
+	//precedence of multiplication and division
+	Sequential bool
+	MinOperand int
+	MaxOperand int
+	MinAnswer  int
+	MaxAnswer  int
+}
+
+func (config ChainConfig) String() string {
+	precedence := "standard"
+	if config.Sequential {
+		precedence = "sequential"
+	}
+	return fmt.Sprintf("%d\t%s\t%s\t%d-%d\t%d-%d", config.Length, strings.Join(config.Operations, ""), precedence, config.MinOperand, config.MaxOperand, config.MinAnswer, config.MaxAnswer)
+}
+
+// tryChain builds one random chain. Every operand but the last is random,
+// and divisions among them are retried until they come out clean. The last
+// operand is then picked from the ones that land the answer in range, so a
+// chain only fails when no operation allows that or a division had no clean
+// divisor. The value is tracked as sum + term, where term is the product term
+// the next multiplication or division applies to; sequential chains keep
+// everything in term.
+func (config ChainConfig) tryChain(rng *rand.Rand) (Problem, bool) {
+	problem := Problem{FirstNum: randRange(rng, config.MinOperand, config.MaxOperand), Sequential: config.Sequential}
+	sum, term := 0, problem.FirstNum
+	for i := 1; i < config.Length-1; i++ {
+		operation := config.Operations[rng.IntN(len(config.Operations))]
+		num := randRange(rng, config.MinOperand, config.MaxOperand)
+		if operation == "/" {
+			found := false
+			for attempt := 0; attempt < maxDivisorAttempts && !found; attempt++ {
+				num = randRange(rng, config.MinOperand, config.MaxOperand)
+				found = num != 0 && term%num == 0
+			}
+			if !found {
+				return Problem{}, false
+			}
+		}
+		problem.appendLink(operation, num)
+
+		var err error
+		switch {
+		case config.Sequential || operation == "*" || operation == "/":
+			term, err = Problem{FirstNum: term, Operation: operation, SecondNum: num}.Answer()
+		case operation == "+":
+			sum, term = sum+term, num
+		default:
+			sum, term = sum+term, -num
+		}
+		if err != nil || abs(sum) > math.MaxInt/4 || abs(term) > math.MaxInt/4 {
+			return Problem{}, false
+		}
+	}
+
+	//the answer is sum + (term op num) for every last operation
+	lo, hi := config.MinAnswer-sum, config.MaxAnswer-sum
+	var choices []Link
+	for _, operation := range config.Operations {
+		if slices.ContainsFunc(choices, func(link Link) bool { return link.Operation == operation }) {
+			continue
+		}
+		if num, ok := config.lastOperand(rng, operation, term, lo, hi); ok {
+			choices = append(choices, Link{operation, num})
+		}
+	}
+	if len(choices) == 0 {
+		return Problem{}, false
+	}
+	last := choices[rng.IntN(len(choices))]
+	problem.appendLink(last.Operation, last.Num)
+	return problem, true
+}
+
+// lastOperand picks an operand in range for which term op num falls in
+// lo-hi, if there is one.
+func (config ChainConfig) lastOperand(rng *rand.Rand, operation string, term int, lo int, hi int) (int, bool) {
+	from, to := config.MinOperand, config.MaxOperand
+	switch operation {
+	case "+":
+		from, to = max(from, lo-term), min(to, hi-term)
+	case "-":
+		from, to = max(from, term-hi), min(to, term-lo)
+	case "*":
+		switch {
+		case term > 0:
+			from, to = max(from, ceilDiv(lo, term)), min(to, floorDiv(hi, term))
+		case term < 0:
+			from, to = max(from, ceilDiv(hi, term)), min(to, floorDiv(lo, term))
+		case lo > 0 || hi < 0:
+			return 0, false
+		}
+	case "/":
+		//every divisor of 0 gives 0, other terms only have divisors up to
+		//their size
+		if term != 0 {
+			from, to = max(from, -abs(term)), min(to, abs(term))
+		} else if lo > 0 || hi < 0 {
+			return 0, false
+		}
+		if to-from >= maxDivisorScan {
+			return 0, false
+		}
+		var divisors []int
+		for num := from; num <= to; num++ {
+			if num != 0 && (term == 0 || term%num == 0 && term/num >= lo && term/num <= hi) {
+				divisors = append(divisors, num)
+			}
+		}
+		if len(divisors) == 0 {
+			return 0, false
+		}
+		return divisors[rng.IntN(len(divisors))], true
+	}
+	if from > to {
+		return 0, false
+	}
+	return randRange(rng, from, to), true
+}
+
+func (problem *Problem) appendLink(operation string, num int) {
+	if len(problem.Operation) == 0 {
+		problem.Operation, problem.SecondNum = operation, num
+	} else {
+		problem.Rest = append(problem.Rest, Link{operation, num})
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func floorDiv(a int, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+func ceilDiv(a int, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) == (b < 0) {
+		q++
+	}
+	return q
+}
+
+// genChainProblem retries until a chain comes out in range. validateConfig
+// checks at least minChainSuccessRate of chains do, so this takes a handful
+// of tries at worst.
+func genChainProblem(rng *rand.Rand, config ChainConfig) Problem {
+	for {
+		if problem, ok := config.tryChain(rng); ok {
+			return problem
+		}
+	}
+}
+
+// chainSuccessRate estimates the share of chains that come out in range, by
+// trying chainSamples of them from a fixed seed.
+func (config ChainConfig) chainSuccessRate() float64 {
+	rng := newRand(1)
+	successes := 0
+	for i := 0; i < chainSamples; i++ {
+		if _, ok := config.tryChain(rng); ok {
+			successes++
+		}
+	}
+	return float64(successes) / chainSamples
+}
+
+type chain struct{}
+
+func (chain) Name() string     { return OpChain }
+func (chain) Describe() string { return "chained expressions" }
+
+func (chain) Generate(rng *rand.Rand, config Config) Problem {
+	return genChainProblem(rng, settingsFor[ChainConfig](config, OpChain))
+}
+
+// Facts can't list chains, since there are too many to deal as a deck.
+func (chain) Facts(config Config, limit int) ([]Problem, bool) {
+	return nil, false
+}
+
+func (chain) Answer(problem Problem) (int, error) {
+	return problem.chainAnswer()
+}
+
+// Format writes the chain out with the usual precedence, or for sequential
+// chains with brackets around each step so it reads left to right
+// unambiguously, as in ((12 + 7) * 3) - 5.
+func (chain) Format(problem Problem) string {
+	links := problem.links()
+	var sb strings.Builder
+	if problem.Sequential {
+		sb.WriteString(strings.Repeat("(", len(links)-2))
+	}
+	sb.WriteString(strconv.Itoa(links[0].Num))
+	for i, link := range links[1:] {
+		sb.WriteString(fmt.Sprintf(" %s %d", link.Operation, link.Num))
+		if problem.Sequential && i < len(links)-2 {
+			sb.WriteString(")")
+		}
+	}
+	return sb.String()
+}
+
+// Parse reads chains of three or more numbers joined by chainOperations,
+// bracketed exactly as Format brackets sequential chains.
+func (op chain) Parse(text string) (Problem, bool) {
+	parts := strings.Split(text, " ")
+	if len(parts) < 5 || len(parts)%2 == 0 {
+		return Problem{}, false
+	}
+	problem := Problem{Sequential: strings.Contains(text, "(")}
+	for i := 0; i < len(parts); i += 2 {
+		num, err := strconv.Atoi(strings.Trim(parts[i], "()"))
+		if err != nil {
+			return Problem{}, false
+		}
+		if i > 0 && !slices.Contains(chainOperations, parts[i-1]) {
+			return Problem{}, false
+		}
+		switch {
+		case i == 0:
+			problem.FirstNum = num
+		case i == 2:
+			problem.Operation, problem.SecondNum = parts[1], num
+		default:
+			problem.Rest = append(problem.Rest, Link{parts[i-1], num})
+		}
+	}
+	//anything Format wouldn't have written, like stray brackets, is rejected
+	if op.Format(problem) != text {
+		return Problem{}, false
+	}
+	return problem, true
+}
+
+// Validate checks the chain rules:
+// 1) between minChainLength and maxChainLength operands
+// 2) at least one operation, all of them basic ones
+// 3) maxes >= mins, with operands and answers within maxChainNumber
+// 4) at least minChainSuccessRate of chains come out in range
+func (chain) Validate(config Config) []string {
+	var errs []string
+	settings := settingsFor[ChainConfig](config, OpChain)
+	if settings.Length < minChainLength || settings.Length > maxChainLength {
+		errs = append(errs, fmt.Sprintf("CHAIN LENGTH OUTSIDE %d-%d", minChainLength, maxChainLength))
+	}
+	if len(settings.Operations) == 0 {
+		errs = append(errs, "NO CHAIN OPERATIONS")
+	}
+	for _, op := range settings.Operations {
+		if !slices.Contains(chainOperations, op) {
+			errs = append(errs, fmt.Sprintf("UNKNOWN CHAIN OPERATION %q", op))
+		}
+	}
+	if settings.MaxOperand < settings.MinOperand || settings.MaxAnswer < settings.MinAnswer {
+		errs = append(errs, "NO POSSIBLE CHAIN OPERANDS")
+	}
+	for _, n := range []int{settings.MinOperand, settings.MaxOperand, settings.MinAnswer, settings.MaxAnswer} {
+		if abs(n) > maxChainNumber {
+			errs = append(errs, fmt.Sprintf("CHAIN NUMBERS OUTSIDE -%d-%d", maxChainNumber, maxChainNumber))
+			break
+		}
+	}
+	if len(errs) == 0 && settings.chainSuccessRate() < minChainSuccessRate {
+		errs = append(errs, fmt.Sprintf("FEWER THAN %d%% OF CHAINS HAVE ANSWERS IN RANGE", int(minChainSuccessRate*100)))
+	}
+	return errs
+}
+
+func (chain) Setup(config *Config, reader *bufio.Reader) {
+	settings := settingsFor[ChainConfig](*config, OpChain)
+	setupChainConfig(&settings, reader)
+	config.setSettings(OpChain, settings)
+}
+
+func (chain) Settings(config Config) any { return settingsFor[ChainConfig](config, OpChain) }
+
+func (chain) SetSettings(config *Config, settings any) { config.setSettings(OpChain, settings) }
+
+func setupChainConfig(config *ChainConfig, reader *bufio.Reader) {
+	fmt.Printf("\r\nNumbers in each chain [%d]: ", config.Length)
+	setIntByInput(getCleanInput(reader), &config.Length)
+	fmt.Printf("\r\nOperations to chain, separated by spaces [%s]: ", strings.Join(config.Operations, " "))
+	line := getCleanInput(reader)
+	if len(line) > 0 {
+		config.Operations = strings.Fields(line)
+	}
+	fmt.Printf("\r\nWork chains strictly left to right, ignoring precedence?%s", bracketCurrentOption(config.Sequential))
+	setByInput(getCleanInput(reader), &config.Sequential)
+	fmt.Printf("\r\nSmallest number [%d]: ", config.MinOperand)
+	setIntByInput(getCleanInput(reader), &config.MinOperand)
+	fmt.Printf("\r\nLargest number [%d]: ", config.MaxOperand)
+	setIntByInput(getCleanInput(reader), &config.MaxOperand)
+	fmt.Printf("\r\nSmallest answer [%d]: ", config.MinAnswer)
+	setIntByInput(getCleanInput(reader), &config.MinAnswer)
+	fmt.Printf("\r\nLargest answer [%d]: ", config.MaxAnswer)
+	setIntByInput(getCleanInput(reader), &config.MaxAnswer)
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errUsage means a command was invoked wrongly. The problem and the usage
+// text have already been printed by the time it is returned.
+var errUsage = errors.New("usage error")
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(paths Paths, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"play", "[--config NAME] [--duration SECONDS] [--seed N]", "play a timed game (the default command)", playCommand},
+		{"practice", "[--config NAME] [--duration SECONDS] [--seed N]", "play a game that reviews due facts first", practiceCommand},
+		{"stats", "[--config NAME]", "show solve time statistics", statsCommand},
+		{"history", "[--config NAME]", "list past games with scores and trends", historyCommand},
+		{"heatmap", "[--config NAME]", "show per-fact solve times for a config's ranges", heatmapCommand},
+		{"config", "", "create or edit a config interactively", configCommand},
+		{"list-configs", "", "list saved configs and presets", listConfigsCommand},
+		{"export", "[--format csv|json] [--output FILE]", "export every solved and unsolved problem", exportCommand},
+		{"migrate", "", "rewrite the score log in the current format", migrateCommand},
+		{"help", "[COMMAND]", "show help for a command", helpCommand},
+	}
+}
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: zetatrack [--data-dir DIR] <command> [flags]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-13s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintf(w, "\nScores and configs are kept under --data-dir or $%s if set, otherwise\n", HomeEnv)
+	fmt.Fprintf(w, "in $XDG_DATA_HOME/zetatrack and $XDG_CONFIG_HOME/zetatrack.\n")
+	fmt.Fprintf(w, "\nRun 'zetatrack help <command>' for the flags of a command.\n")
+}
+
+// run executes the command line and returns the process exit code: 0 on
+// success, 1 when the command fails and 2 when it is used incorrectly. Files
+// older versions left in legacyDir are moved into the default locations
+// first, and the command still runs if that fails; an empty legacyDir skips
+// that.
+func run(args []string, legacyDir string) int {
+	global := flag.NewFlagSet("zetatrack", flag.ContinueOnError)
+	global.Usage = func() { printUsage(global.Output()) }
+	dataDir := global.String("data-dir", "", "")
+	err := global.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		return 2
+	}
+	args = global.Args()
+	if len(args) == 0 {
+		args = []string{"play"}
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "zetatrack: unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return 2
+	}
+
+	paths, err := resolvePaths(*dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "zetatrack: %v\n", err)
+		return 1
+	}
+	//an explicit data directory is somewhere the player chose, not where
+	//older versions kept files, so nothing is moved into it
+	explicit := len(*dataDir) > 0 || len(os.Getenv(HomeEnv)) > 0
+	if len(legacyDir) > 0 && !explicit {
+		err = migrateWorkingDirFiles(legacyDir, paths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "zetatrack: couldn't move old files into %s: %v\n", paths.DataDir, err)
+		}
+	}
+
+	err = cmd.run(paths, args[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	default:
+		fmt.Fprintf(os.Stderr, "\r\nzetatrack %s: %v\r\n", cmd.name, err)
+		return 1
+	}
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		cmd := findCommand(name)
+		fmt.Fprintf(flags.Output(), "Usage: zetatrack %s %s\n\n%s\n", cmd.name, cmd.args, cmd.summary)
+		hasFlags := false
+		flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(flags.Output(), "\nFlags:\n")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+// parseFlags parses a command's flags, rejecting stray positional arguments.
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	if err != nil {
+		return errUsage
+	}
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "unexpected argument %q\n", flags.Arg(0))
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func scoresFlag(flags *flag.FlagSet, paths Paths) *string {
+	return flags.String("scores", paths.Scores(), "score log `file`")
+}
+
+// gameFlags are the flags shared by every command that plays a game.
+type gameFlags struct {
+	flags    *flag.FlagSet
+	config   *string
+	duration *int
+	seed     *uint64
+	scores   *string
+	paths    Paths
+}
+
+func newGameFlags(name string, paths Paths) gameFlags {
+	flags := newFlagSet(name)
+	return gameFlags{
+		flags:    flags,
+		config:   flags.String("config", "", "config `name` to play (default: the default config)"),
+		duration: flags.Int("duration", 0, "game length in `seconds`, overriding the config"),
+		seed:     flags.Uint64("seed", 0, "replay the problem sequence of this `seed`, overriding the config"),
+		scores:   scoresFlag(flags, paths),
+		paths:    paths,
+	}
+}
+
+// loadConfig parses the game flags and returns the validated config they
+// select, with any overrides applied.
+func (game gameFlags) loadConfig(args []string) (Config, error) {
+	err := parseFlags(game.flags, args)
+	if err != nil {
+		return Config{}, err
+	}
+	config, err := loadNamedConfig(game.paths, *game.config)
+	if err != nil {
+		return Config{}, err
+	}
+	if isFlagSet(game.flags, "duration") {
+		config.Duration = *game.duration
+	}
+	if isFlagSet(game.flags, "seed") {
+		config.Seed = *game.seed
+	}
+	err = validateConfig(&config)
+	if err != nil {
+		return Config{}, err
+	}
+	seedConfig(&config)
+	return config, nil
+}
+
+// readHistory reads the score log a game draws on for balancing, adaptive
+// difficulty and the personal best. Corrupt lines are skipped, and a missing
+// log just means no history yet.
+func readHistory(scoresPath string) []Log {
+	logs, _ := readLogs(scoresPath)
+	return logs
+}
+
+func playCommand(paths Paths, args []string) error {
+	game := newGameFlags("play", paths)
+	config, err := game.loadConfig(args)
+	if err != nil {
+		return err
+	}
+	logs := readHistory(*game.scores)
+	return playGame(config, newProblemSource(config, logs), *game.scores, logs)
+}
+
+func practiceCommand(paths Paths, args []string) error {
+	game := newGameFlags("practice", paths)
+	config, err := game.loadConfig(args)
+	if err != nil {
+		return err
+	}
+	logs := readHistory(*game.scores)
+	source, err := newPracticeSource(config, *game.scores, logs)
+	if err != nil {
+		return err
+	}
+	return playGame(config, source, *game.scores, logs)
+}
+
+func statsCommand(paths Paths, args []string) error {
+	flags := newFlagSet("stats")
+	configFilter := flags.String("config", "", "only include games played with this config `name` or fingerprint")
+	scores := scoresFlag(flags, paths)
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	return printStats(*scores, *configFilter)
+}
+
+func historyCommand(paths Paths, args []string) error {
+	flags := newFlagSet("history")
+	configFilter := flags.String("config", "", "only include games played with this config `name` or fingerprint")
+	scores := scoresFlag(flags, paths)
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	return printHistory(*scores, *configFilter)
+}
+
+func heatmapCommand(paths Paths, args []string) error {
+	flags := newFlagSet("heatmap")
+	configName := flags.String("config", "", "config `name` whose operand ranges are shown (default: the default config)")
+	scores := scoresFlag(flags, paths)
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	config, err := loadNamedConfig(paths, *configName)
+	if err != nil {
+		return err
+	}
+	return printHeatmaps(*scores, config)
+}
+
+func configCommand(paths Paths, args []string) error {
+	err := parseFlags(newFlagSet("config"), args)
+	if err != nil {
+		return err
+	}
+	return setupConfig(paths)
+}
+
+func listConfigsCommand(paths Paths, args []string) error {
+	err := parseFlags(newFlagSet("list-configs"), args)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(paths.ConfigDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".txt") {
+			names = append(names, strings.TrimSuffix(entry.Name(), ".txt"))
+		}
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Printf("No saved configs, the built-in zetamac config is used by default\r\n")
+	}
+	for _, name := range names {
+		config, err := loadConfigFile(paths.Config(name), nil)
+		if err != nil {
+			fmt.Printf("%-16s (unreadable: %v)\r\n", name, err)
+			continue
+		}
+		fmt.Printf("%-16s %4ds  %-8s %s\r\n", name, config.Duration, strings.Join(config.LegalOperations, " "), config.Fingerprint())
+	}
+	fmt.Printf("\r\nPresets, usable by name or with \"Extends\" in a saved config:\r\n")
+	for _, preset := range presets {
+		fmt.Printf("%-18s %s\r\n", preset.name, preset.summary)
+	}
+	return nil
+}
+
+func exportCommand(paths Paths, args []string) error {
+	flags := newFlagSet("export")
+	format := flags.String("format", "csv", "output `format`: csv (one row per problem) or json (one game per line)")
+	output := flags.String("output", "", "write to `file` instead of standard output")
+	scores := scoresFlag(flags, paths)
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		fmt.Fprintf(flags.Output(), "unknown format %q\n", *format)
+		flags.Usage()
+		return errUsage
+	}
+
+	logs, err := readLogs(*scores)
+	var corrupt *CorruptLogError
+	if errors.As(err, &corrupt) {
+		fmt.Fprintf(os.Stderr, "WARNING: skipping %v\n", err)
+	} else if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if len(*output) > 0 {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if *format == "json" {
+		for _, log := range logs {
+			_, err = io.WriteString(w, log.String())
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return writeCSV(w, logs)
+}
+
+func writeCSV(w io.Writer, logs []Log) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"time", "config", "fingerprint", "seed", "length", "index", "problem", "operation", "first", "second", "solve_ms"})
+	for _, log := range logs {
+		for i, problem := range log.Problems {
+			solveTime := int64(-1)
+			if i < len(log.Times) {
+				solveTime = log.Times[i]
+			}
+			writer.Write([]string{
+				log.LogTime.Format(time.RFC3339),
+				log.ConfigName,
+				log.ConfigFingerprint,
+				strconv.FormatUint(log.Seed, 10),
+				strconv.Itoa(log.GameLength),
+				strconv.Itoa(i),
+				problem.String(),
+				problem.Kind(),
+				strconv.Itoa(problem.FirstNum),
+				strconv.Itoa(problem.SecondNum),
+				strconv.FormatInt(solveTime, 10),
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func migrateCommand(paths Paths, args []string) error {
+	flags := newFlagSet("migrate")
+	scores := scoresFlag(flags, paths)
+	err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	return migrateScores(*scores)
+}
+
+func helpCommand(paths Paths, args []string) error {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return nil
+	}
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "zetatrack: unknown command %q\n\n", args[0])
+		printUsage(os.Stderr)
+		return errUsage
+	}
+	if cmd.name == "help" {
+		printUsage(os.Stdout)
+		return nil
+	}
+	return cmd.run(paths, []string{"-h"})
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	KeyBackspace rune = 0x7f
+	KeyQuit      rune = 'q'
+	//KeyInterrupt is Ctrl-C, which a raw terminal delivers as a key rather
+	//than a SIGINT
+	KeyInterrupt rune = 0x03
+)
+
+// maxAnswerLength caps how many characters the player can type as an answer.
+const maxAnswerLength = 10
+
+// KeyEvent is a single key press, stamped with when it was read.
+type KeyEvent struct {
+	Key rune
+	At  time.Time
+}
+
+// InputSource delivers the player's key presses. The channel is closed when
+// input ends, which ends the game like a quit.
+type InputSource interface {
+	Keys() <-chan KeyEvent
+}
+
+// Renderer shows the game to the player.
+type Renderer interface {
+	Start(config Config)
+	ShowProblem(problem Problem)
+	ShowAnswer(problem Problem, answer string)
+	ShowStatus(status Status)
+	Finish(score int)
+}
+
+// Status is the live state of a game, shown once when it starts and then
+// every second.
+type Status struct {
+	Remaining time.Duration
+	Score     int
+	//BestScore is how many problems the personal best game had solved at the
+	//same point, or -1 when there is no personal best
+	BestScore int
+}
+
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// Game plays a single timed game: it hands out problems from Source, builds
+// up answers from Input, and reports everything through Renderer.
+type Game struct {
+	Config   Config
+	Source   ProblemSource
+	Input    InputSource
+	Renderer Renderer
+	Clock    Clock
+	//Best is the personal best game for Config, whose progress is shown as
+	//the pace to beat. It may be nil.
+	Best *Log
+}
+
+// Run plays until the time runs out, the player quits or ctx is cancelled,
+// and returns the log of the game. All game state is owned by the calling
+// goroutine, so however the game ends it finishes exactly once.
+// A problem with no answer ends the game with an error.
+// Other errors, like a failed practice save, are returned at the end.
+// The log is complete either way.
+func (game *Game) Run(ctx context.Context) (Log, error) {
+	var problems []Problem
+	var firstErr error
+	var times []int64
+	var keystrokes [][]Keystroke
+	var answers []string
+	score := 0
+
+	game.Renderer.Start(game.Config)
+	startTime := game.Clock.Now()
+	duration := time.Duration(game.Config.Duration) * time.Second
+	timeUp := game.Clock.After(duration)
+	keys := game.Input.Keys()
+	//ticks are scheduled from the start time rather than the previous tick so
+	//a slow redraw doesn't make the countdown drift
+	played := time.Duration(0)
+	tick := game.Clock.After(time.Second)
+	//each problem is shown the moment the previous one is solved
+	problemStart := startTime
+
+	record := func(problem Problem, ms int64) {
+		if recorder, ok := game.Source.(resultRecorder); ok {
+			if err := recorder.Record(problem, ms); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	finish := func() (Log, error) {
+		if len(times) < len(problems) {
+			record(problems[len(problems)-1], -1)
+		}
+		game.Renderer.Finish(score)
+		log := NewLog(problems, times, game.Config.Duration)
+		log.LogTime = startTime
+		log.ConfigName = game.Config.Name
+		log.ConfigFingerprint = game.Config.Fingerprint()
+		log.Seed = game.Config.Seed
+		log.Keystrokes = keystrokes
+		log.Answers = answers
+		if source, ok := game.Source.(weightedSource); ok {
+			log.Weights = source.Weights()
+		}
+		return log, firstErr
+	}
+	showStatus := func() {
+		status := Status{Remaining: duration - played, Score: score, BestScore: -1}
+		if game.Best != nil && game.Config.Duration > 0 {
+			//a personal best of a different length is stretched to this one
+			status.BestScore = game.Best.ScoreAt(played * time.Duration(game.Best.GameLength) / time.Duration(game.Config.Duration))
+		}
+		game.Renderer.ShowStatus(status)
+	}
+	showStatus()
+
+	for {
+		problem := game.Source.Next()
+		correct, err := game.Config.ExpectedAnswer(problem)
+		if err != nil {
+			//a problem without an answer can't be played, so the game ends
+			//before showing it
+			log, recordErr := finish()
+			return log, errors.Join(recordErr, fmt.Errorf("evaluating %s: %w", problem, err))
+		}
+		problems = append(problems, problem)
+		answers = append(answers, correct)
+		keystrokes = append(keystrokes, nil)
+		game.Renderer.ShowProblem(problem)
+		answer := ""
+
+		for answer != correct {
+			var event KeyEvent
+			var ok bool
+			select {
+			case <-ctx.Done():
+				return finish()
+			case <-timeUp:
+				return finish()
+			case <-tick:
+				played += time.Second
+				if played < duration {
+					tick = game.Clock.After(startTime.Add(played + time.Second).Sub(game.Clock.Now()))
+					showStatus()
+				}
+				continue
+			case event, ok = <-keys:
+			}
+			if !ok || event.Key == KeyQuit || event.Key == KeyInterrupt {
+				return finish()
+			}
+
+			next, changed := editAnswer(answer, event.Key)
+			if !changed {
+				continue
+			}
+			answer = next
+			game.Renderer.ShowAnswer(problem, answer)
+			elapsed := event.At.Sub(problemStart).Milliseconds()
+			keystrokes[len(keystrokes)-1] = append(keystrokes[len(keystrokes)-1], Keystroke{elapsed, answer})
+			if answer == correct {
+				times = append(times, elapsed)
+				record(problem, elapsed)
+				score++
+				problemStart = event.At
+				showStatus()
+			}
+		}
+	}
+}
+
+// editAnswer applies a key press to the answer being typed, reporting
+// whether it changed anything. A minus sign is only accepted as the first
+// character, so negative answers can be typed the way they are written, and
+// one decimal point or remainder marker may follow the first digit.
+func editAnswer(answer string, key rune) (string, bool) {
+	if key == KeyBackspace {
+		if len(answer) == 0 {
+			return answer, false
+		}
+		return answer[:len(answer)-1], true
+	}
+	if len(answer) >= maxAnswerLength {
+		return answer, false
+	}
+	switch {
+	case key == '-' && len(answer) == 0:
+	case key == '.' || key == 'r':
+		if len(answer) == 0 || answer[len(answer)-1] < '0' || answer[len(answer)-1] > '9' || strings.ContainsAny(answer, ".r") {
+			return answer, false
+		}
+	case key < '0' || key > '9':
+		return answer, false
+	}
+	return answer + string(key), true
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// ProblemSource hands out the problems of a single game, one at a time.
+type ProblemSource interface {
+	Next() Problem
+}
+
+const (
+	//maxRepeatWindow bounds Config.NoRepeatWindow
+	maxRepeatWindow = 1000
+	//maxRepeatAttempts bounds how many problems are generated looking for
+	//one outside the repeat window, for configs with too few facts to fill it
+	maxRepeatAttempts = 100
+	//maxDeckSize bounds how many facts each operation can deal in deck mode
+	maxDeckSize = 100_000
+)
+
+// dealer hands out problems under the config's generation policies: no
+// repeats within the repeat window and, in deck mode, every fact of an
+// operation once before any of them again.
+type dealer struct {
+	config Config
+	rng    *rand.Rand
+	//recent holds the facts of the last NoRepeatWindow problems
+	recent []string
+	//piles holds what is left of each operation's shuffled deck
+	piles map[string][]Problem
+}
+
+func newDealer(config Config, rng *rand.Rand) *dealer {
+	return &dealer{config: config, rng: rng, piles: make(map[string][]Problem)}
+}
+
+func (dealer *dealer) Next() Problem {
+	problem := dealer.draw()
+	dealer.remember(problem)
+	return problem
+}
+
+// draw picks the next problem without remembering it, so callers choosing
+// between several can remember only the one they use.
+func (dealer *dealer) draw() Problem {
+	if dealer.config.DeckMode {
+		return dealer.deal()
+	}
+	problem := genProblem(dealer.rng, dealer.config)
+	for attempt := 1; attempt < maxRepeatAttempts && dealer.isRecent(problem); attempt++ {
+		problem = genProblem(dealer.rng, dealer.config)
+	}
+	return problem
+}
+
+// deal takes the next card from the pile of an operation picked by weight,
+// shuffling a fresh deck whenever the pile runs out.
+func (dealer *dealer) deal() Problem {
+	operation := dealer.config.pickOperation(dealer.rng)
+	pile := dealer.piles[operation]
+	if len(pile) == 0 {
+		//validateConfig checks every enabled operation can be dealt
+		pile, _ = lookupOperation(operation).Facts(dealer.config, maxDeckSize)
+		pile = dealer.distinct(pile)
+		dealer.rng.Shuffle(len(pile), func(i, j int) {
+			pile[i], pile[j] = pile[j], pile[i]
+		})
+	}
+	//a fresh deck can start with a card just dealt from the last one
+	for i, problem := range pile {
+		if !dealer.isRecent(problem) {
+			pile[0], pile[i] = pile[i], pile[0]
+			break
+		}
+	}
+	dealer.piles[operation] = pile[1:]
+	return pile[0]
+}
+
+// distinct drops facts that repeat an earlier one, keeping the first.
+func (dealer *dealer) distinct(facts []Problem) []Problem {
+	seen := make(map[string]bool)
+	var res []Problem
+	for _, problem := range facts {
+		fact := dealer.fact(problem)
+		if !seen[fact] {
+			seen[fact] = true
+			res = append(res, problem)
+		}
+	}
+	return res
+}
+
+// fact names the fact problem tests, which is the same for 3 * 7 and 7 * 3
+// when commutative duplicates are suppressed.
+func (dealer *dealer) fact(problem Problem) string {
+	if dealer.config.SuppressCommutative && !problem.IsChain() && (problem.Operation == "+" || problem.Operation == "*") && problem.FirstNum > problem.SecondNum {
+		problem.FirstNum, problem.SecondNum = problem.SecondNum, problem.FirstNum
+	}
+	return problem.String()
+}
+
+func (dealer *dealer) isRecent(problem Problem) bool {
+	fact := dealer.fact(problem)
+	for _, recent := range dealer.recent {
+		if recent == fact {
+			return true
+		}
+	}
+	return false
+}
+
+func (dealer *dealer) remember(problem Problem) {
+	if dealer.config.NoRepeatWindow <= 0 {
+		return
+	}
+	dealer.recent = append(dealer.recent, dealer.fact(problem))
+	if len(dealer.recent) > dealer.config.NoRepeatWindow {
+		dealer.recent = dealer.recent[1:]
+	}
+}
+
+// validatePolicies checks the generation policy rules:
+// 1) a repeat window between 0 and maxRepeatWindow
+// 2) deck mode only without adaptive, and for operations that can be dealt
+func (config Config) validatePolicies() []string {
+	var errs []string
+	if config.NoRepeatWindow < 0 || config.NoRepeatWindow > maxRepeatWindow {
+		errs = append(errs, fmt.Sprintf("REPEAT WINDOW OUTSIDE 0-%d", maxRepeatWindow))
+	}
+	if !config.DeckMode {
+		return errs
+	}
+	if config.Adaptive {
+		errs = append(errs, "DECK MODE CAN'T BE ADAPTIVE")
+	}
+	for _, op := range operations {
+		if !config.enables(op.Name()) {
+			continue
+		}
+		if _, ok := op.Facts(config, maxDeckSize); !ok {
+			errs = append(errs, fmt.Sprintf("CAN'T DEAL %s AS A DECK OF AT MOST %d", strings.ToUpper(op.Describe()), maxDeckSize))
+		}
+	}
+	return errs
+}
+
+// adaptiveCandidates is how many uniformly generated problems the adaptive
+// source chooses between; more candidates bias harder towards slow facts.
+const adaptiveCandidates = 6
+
+// adaptiveSource draws several candidate problems from the config and picks
+// one with probability proportional to its estimated difficulty, so every
+// problem still respects the config's operand ranges.
+type adaptiveSource struct {
+	dealer     *dealer
+	difficulty Difficulty
+}
+
+func (source *adaptiveSource) Next() Problem {
+	candidates := make([]Problem, adaptiveCandidates)
+	weights := make([]int64, adaptiveCandidates)
+	var total int64
+	for i := range candidates {
+		candidates[i] = source.dealer.draw()
+		weights[i] = source.difficulty.Estimate(candidates[i])
+		total += weights[i]
+	}
+	pick := randRange(source.dealer.rng, 0, int(total)-1)
+	chosen := candidates[len(candidates)-1]
+	for i, weight := range weights {
+		if pick < int(weight) {
+			chosen = candidates[i]
+			break
+		}
+		pick -= int(weight)
+	}
+	source.dealer.remember(chosen)
+	return chosen
+}
+
+// Difficulty estimates how long each fact takes to solve from past games.
+type Difficulty struct {
+	prior int64
+	total map[string]int64
+	count map[string]int64
+}
+
+// EstimateDifficulty builds per-fact difficulty from historical logs. A
+// problem left unsolved at the end of a game counts as a miss, scored as
+// twice the overall median solve time.
+func EstimateDifficulty(logs []Log) Difficulty {
+	difficulty := Difficulty{total: make(map[string]int64), count: make(map[string]int64)}
+	var times []int64
+	for _, log := range logs {
+		for _, time := range log.Times {
+			if time != -1 {
+				times = append(times, time)
+			}
+		}
+	}
+	difficulty.prior = max(median(times), 1)
+
+	for _, log := range logs {
+		for i, problem := range log.Problems {
+			time := int64(-1)
+			if i < len(log.Times) {
+				time = log.Times[i]
+			}
+			if time == -1 {
+				time = 2 * difficulty.prior
+			}
+			key := problem.String()
+			difficulty.total[key] += time
+			difficulty.count[key]++
+		}
+	}
+	return difficulty
+}
+
+// Estimate returns the expected solve time of problem in milliseconds. Facts
+// are smoothed towards the overall median so a single slow solve doesn't
+// dominate, and unseen facts get the median itself.
+func (difficulty Difficulty) Estimate(problem Problem) int64 {
+	key := problem.String()
+	return max((difficulty.total[key]+difficulty.prior)/(difficulty.count[key]+1), 1)
+}
+
+// newProblemSource picks the source for a regular game, seeded from
+// config.Seed. Adaptive and balanced games also depend on the history in
+// logs, so they only replay identically against the same history; a balanced
+// game's log records the weights it was drawn with, which replay it from the
+// seed under any history.
+func newProblemSource(config Config, logs []Log) ProblemSource {
+	config = balanceOperations(config, logs)
+	rng := newRand(config.Seed)
+	if config.Adaptive && len(logs) > 0 {
+		return &adaptiveSource{dealer: newDealer(config, rng), difficulty: EstimateDifficulty(logs)}
+	}
+	return newDealer(config, rng)
+}
+
+// balanceScale turns mean solve times in milliseconds into weights.
+const balanceScale = 1_000_000
+
+// BalancedWeights weights each of config's operations inversely to its mean
+// solve time in logs, so a game spends about as long on each. Operations
+// without history get the mean over every operation.
+func BalancedWeights(logs []Log, config Config) map[string]int {
+	byOperation := SolveTimesByOperation(logs)
+	var all []int64
+	for _, times := range byOperation {
+		all = append(all, times...)
+	}
+	prior := max(mean(all), 1)
+	weights := make(map[string]int)
+	for _, op := range config.LegalOperations {
+		average := prior
+		if times := byOperation[op]; len(times) > 0 {
+			average = max(mean(times), 1)
+		}
+		weights[op] = int(max(balanceScale/average, 1))
+	}
+	return weights
+}
+
+// weightedSource is a source that can report the weights it draws operations
+// with, for the log to record.
+type weightedSource interface {
+	Weights() map[string]int
+}
+
+// Weights returns the weights operations are drawn with when they were
+// balanced from history, which the config alone doesn't record, or nil.
+func (dealer *dealer) Weights() map[string]int {
+	if !dealer.config.BalanceOperations {
+		return nil
+	}
+	return dealer.config.effectiveWeights()
+}
+
+func (source *adaptiveSource) Weights() map[string]int {
+	return source.dealer.Weights()
+}
+
+// balanceOperations swaps config's weights for BalancedWeights from logs, if
+// the config asks for it and there is history.
+func balanceOperations(config Config, logs []Log) Config {
+	if config.BalanceOperations && len(logs) > 0 {
+		config.Weights = BalancedWeights(logs, config)
+	}
+	return config
+}
@@ -2,9 +2,6 @@ module github.com/cooperaterrill/zetatrack
 
 go 1.24.3
 
-require (
-	github.com/Knetic/govaluate v3.0.0+incompatible
-	golang.org/x/term v0.32.0
-)
+require golang.org/x/term v0.32.0
 
 require golang.org/x/sys v0.33.0 // indirect
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxHeatmapCells caps the width and height of a heatmap grid. Wider operand
+// ranges are grouped into bins of several operands per cell.
+const maxHeatmapCells = 40
+
+var heatmapShades = []string{"░░", "▒▒", "▓▓", "██"}
+
+const heatmapEmpty = "··"
+
+type Fact struct {
+	Left  int
+	Right int
+}
+
+// SolveTimesByFact groups the solve times of every solved problem with the
+// given operation by its operand pair.
+func SolveTimesByFact(logs []Log, operation string) map[Fact][]int64 {
+	res := make(map[Fact][]int64)
+	for _, log := range logs {
+		for i, problem := range log.Problems {
+			if problem.Kind() != operation || i >= len(log.Times) || log.Times[i] == -1 {
+				continue
+			}
+			fact := Fact{problem.FirstNum, problem.SecondNum}
+			res[fact] = append(res[fact], log.Times[i])
+		}
+	}
+	return res
+}
+
+func binWidth(min int, max int) int {
+	span := max - min + 1
+	return (span + maxHeatmapCells - 1) / maxHeatmapCells
+}
+
+// renderHeatmap draws a grid of median solve times for every operand pair in
+// the given ranges, darker cells being slower.
+func renderHeatmap(byFact map[Fact][]int64, minLeft int, maxLeft int, minRight int, maxRight int) string {
+	rowWidth := binWidth(minLeft, maxLeft)
+	colWidth := binWidth(minRight, maxRight)
+	rows := (maxLeft-minLeft)/rowWidth + 1
+	cols := (maxRight-minRight)/colWidth + 1
+
+	cells := make([][]int64, rows*cols)
+	for fact, times := range byFact {
+		if fact.Left < minLeft || fact.Left > maxLeft || fact.Right < minRight || fact.Right > maxRight {
+			continue
+		}
+		row := (fact.Left - minLeft) / rowWidth
+		col := (fact.Right - minRight) / colWidth
+		cells[row*cols+col] = append(cells[row*cols+col], times...)
+	}
+
+	medians := make([]int64, len(cells))
+	var lowest, highest int64 = -1, -1
+	for i, times := range cells {
+		if len(times) == 0 {
+			medians[i] = -1
+			continue
+		}
+		medians[i] = median(times)
+		if lowest == -1 || medians[i] < lowest {
+			lowest = medians[i]
+		}
+		if highest == -1 || medians[i] > highest {
+			highest = medians[i]
+		}
+	}
+
+	var sb strings.Builder
+	if rowWidth > 1 || colWidth > 1 {
+		sb.WriteString(fmt.Sprintf("(%d left x %d right operands per cell)\r\n", rowWidth, colWidth))
+	}
+	sb.WriteString(fmt.Sprintf("%6s ", ""))
+	for col := 0; col < cols; col++ {
+		label := minRight + col*colWidth
+		if col%5 == 0 {
+			sb.WriteString(fmt.Sprintf("%-10d", label))
+		}
+	}
+	sb.WriteString("\r\n")
+	for row := 0; row < rows; row++ {
+		sb.WriteString(fmt.Sprintf("%6d ", minLeft+row*rowWidth))
+		for col := 0; col < cols; col++ {
+			med := medians[row*cols+col]
+			if med == -1 {
+				sb.WriteString(heatmapEmpty)
+				continue
+			}
+			shade := 0
+			if highest > lowest {
+				shade = int((med - lowest) * int64(len(heatmapShades)) / (highest - lowest + 1))
+			}
+			sb.WriteString(heatmapShades[shade])
+		}
+		sb.WriteString("\r\n")
+	}
+	if lowest != -1 {
+		sb.WriteString(fmt.Sprintf("%s %dms ... %s %dms, %s no data\r\n", heatmapShades[0], lowest, heatmapShades[len(heatmapShades)-1], highest, heatmapEmpty))
+	}
+	return sb.String()
+}
+
+// slowestFacts lists up to n facts ordered by median solve time, slowest first.
+func slowestFacts(byFact map[Fact][]int64, n int) []Fact {
+	facts := make([]Fact, 0, len(byFact))
+	medians := make(map[Fact]int64, len(byFact))
+	for fact, times := range byFact {
+		facts = append(facts, fact)
+		medians[fact] = median(times)
+	}
+	sort.Slice(facts, func(i int, j int) bool {
+		if medians[facts[i]] != medians[facts[j]] {
+			return medians[facts[i]] > medians[facts[j]]
+		}
+		if facts[i].Left != facts[j].Left {
+			return facts[i].Left < facts[j].Left
+		}
+		return facts[i].Right < facts[j].Right
+	})
+	if len(facts) > n {
+		facts = facts[:n]
+	}
+	return facts
+}
+
+func printHeatmaps(filepath string, config Config) error {
+	logs, err := readLogsForReport(filepath)
+	if err != nil {
+		return err
+	}
+
+	printOne := func(operation string, name string, minLeft int, maxLeft int, minRight int, maxRight int) {
+		if maxLeft < minLeft || maxRight < minRight {
+			return
+		}
+		byFact := SolveTimesByFact(logs, operation)
+		fmt.Printf("\r\n%s (%d-%d %s %d-%d)\r\n", name, minLeft, maxLeft, operation, minRight, maxRight)
+		fmt.Printf("%s", renderHeatmap(byFact, minLeft, maxLeft, minRight, maxRight))
+		slowest := slowestFacts(byFact, 10)
+		if len(slowest) == 0 {
+			return
+		}
+		fmt.Printf("Slowest facts:\r\n")
+		for _, fact := range slowest {
+			times := byFact[fact]
+			fmt.Printf("  %s: %dms (%d solves)\r\n", Problem{FirstNum: fact.Left, Operation: operation, SecondNum: fact.Right}, median(times), len(times))
+		}
+	}
+
+	add := config.AdditionConfig
+	printOne("+", "Addition", add.MinLeft, add.MaxLeft, add.MinRight, add.MaxRight)
+	mult := config.MultiplicationConfig
+	printOne("*", "Multiplication", mult.MinLeft, mult.MaxLeft, mult.MinRight, mult.MaxRight)
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NormalizedDuration is the game length, in seconds, that history scores are
+// scaled to so games of different lengths can be compared.
+const NormalizedDuration = 120
+
+// rollingWindow is how many games the rolling average covers.
+const rollingWindow = 5
+
+// sparklineWidth caps how many of the most recent games the trend chart shows.
+const sparklineWidth = 60
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// Score is the number of problems solved in the game.
+func (log Log) Score() int {
+	score := 0
+	for _, time := range log.Times {
+		if time != -1 {
+			score++
+		}
+	}
+	return score
+}
+
+// NormalizedScore scales the score to a NormalizedDuration second game.
+func (log Log) NormalizedScore() float64 {
+	if log.GameLength <= 0 {
+		return float64(log.Score())
+	}
+	return float64(log.Score()) * NormalizedDuration / float64(log.GameLength)
+}
+
+// ScoreAt is how many problems had been solved elapsed into the game.
+func (log Log) ScoreAt(elapsed time.Duration) int {
+	score := 0
+	total := int64(0)
+	for _, solveTime := range log.Times {
+		if solveTime == -1 {
+			break
+		}
+		total += solveTime
+		if total > elapsed.Milliseconds() {
+			break
+		}
+		score++
+	}
+	return score
+}
+
+// personalBest finds the best game played with the same ranges as config,
+// comparing games of different lengths by normalized score.
+func personalBest(logs []Log, config Config) (Log, bool) {
+	fingerprint := config.Fingerprint()
+	var best Log
+	found := false
+	for _, log := range logs {
+		if log.ConfigFingerprint != fingerprint {
+			continue
+		}
+		if !found || log.NormalizedScore() > best.NormalizedScore() {
+			best = log
+			found = true
+		}
+	}
+	return best, found
+}
+
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, value := range values {
+		lowest = min(lowest, value)
+		highest = max(highest, value)
+	}
+	var sb strings.Builder
+	for _, value := range values {
+		tick := 0
+		if highest > lowest {
+			tick = int((value - lowest) / (highest - lowest) * float64(len(sparkTicks)-1))
+		}
+		sb.WriteRune(sparkTicks[tick])
+	}
+	return sb.String()
+}
+
+func printHistory(filepath string, configFilter string) error {
+	allLogs, err := readLogsForReport(filepath)
+	if err != nil {
+		return err
+	}
+	var logs []Log
+	for _, log := range allLogs {
+		if log.matchesConfig(configFilter) {
+			logs = append(logs, log)
+		}
+	}
+	sort.SliceStable(logs, func(i int, j int) bool {
+		return logs[i].LogTime.Before(logs[j].LogTime)
+	})
+	if len(logs) == 0 {
+		fmt.Printf("No games recorded\r\n")
+		return nil
+	}
+
+	fmt.Printf("%-16s %-12s %6s %6s %8s %8s\r\n", "Date", "Config", "Length", "Score", "Per120s", "Rolling")
+	best := make(map[string]float64)
+	var normalized []float64
+	for i, log := range logs {
+		name := log.ConfigName
+		if name == "" {
+			name = "-"
+		}
+		score := log.NormalizedScore()
+		normalized = append(normalized, score)
+		window := normalized[max(0, i+1-rollingWindow):]
+		var sum float64
+		for _, value := range window {
+			sum += value
+		}
+
+		marker := ""
+		if previous, ok := best[name]; !ok || score > previous {
+			best[name] = score
+			marker = " PB"
+		}
+		fmt.Printf("%-16s %-12s %6d %6d %8.1f %8.1f%s\r\n", log.LogTime.Local().Format("2006-01-02 15:04"), name, log.GameLength, log.Score(), score, sum/float64(len(window)), marker)
+	}
+
+	fmt.Printf("\r\nPersonal bests (per %ds):\r\n", NormalizedDuration)
+	var names []string
+	for name := range best {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-12s %6.1f\r\n", name, best[name])
+	}
+
+	trend := normalized[max(0, len(normalized)-sparklineWidth):]
+	fmt.Printf("\r\nTrend (last %d games): %s\r\n", len(trend), sparkline(trend))
+	return nil
+}
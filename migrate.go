@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// migrateScores rewrites every line of a score log in the current versioned
+// format. The original file is kept next to it with a .bak suffix, numbered
+// if an earlier backup is already there. Nothing is rewritten if every line is
+// current, or if any line fails to parse, since that line would be lost.
+func migrateScores(filepath string) error {
+	logs, err := readLogs(filepath)
+	if err != nil {
+		return err
+	}
+
+	var migrated []byte
+	count := 0
+	for _, log := range logs {
+		if log.Version < LogVersion {
+			count++
+		}
+		migrated = append(migrated, log.String()...)
+	}
+	if count == 0 {
+		fmt.Printf("All %d games in %s are already in the current format\r\n", len(logs), filepath)
+		return nil
+	}
+
+	original, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
+	}
+	backup := backupPath(filepath)
+	err = writeFileAtomic(backup, original)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(filepath, migrated)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Migrated %d of %d games in %s (backup saved to %s)\r\n", count, len(logs), filepath, backup)
+	return nil
+}
+
+// backupPath is the first of path.bak, path.bak.1, path.bak.2 and so on that
+// doesn't exist yet.
+func backupPath(path string) string {
+	backup := path + ".bak"
+	for i := 1; fileExists(backup); i++ {
+		backup = fmt.Sprintf("%s.bak.%d", path, i)
+	}
+	return backup
+}
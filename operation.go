@@ -0,0 +1,598 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Operation is one kind of problem a config can enable. Adding an operation
+// takes an implementation and an entry in operations; the generator,
+// validator, setup wizard, config JSON, problem text and stats all pick it up
+// from there.
+type Operation interface {
+	//Name is how the operation is listed in Config.LegalOperations and
+	//grouped in stats
+	Name() string
+	//Describe names the operation for the player, as in "Enable addition?"
+	Describe() string
+	Generate(rng *rand.Rand, config Config) Problem
+	//Facts lists every problem Generate can produce, or reports false if
+	//there are more than limit or they can't be listed
+	Facts(config Config, limit int) ([]Problem, bool)
+	Answer(problem Problem) (int, error)
+	//Format writes a problem of the operation the way the player sees it
+	Format(problem Problem) string
+	//Parse reads back a problem written by Format, reporting false if text
+	//isn't in the operation's form
+	Parse(text string) (Problem, bool)
+	//Validate lists what is wrong with the operation's settings, each as a
+	//CONFIG ERROR message
+	Validate(config Config) []string
+	Setup(config *Config, reader *bufio.Reader)
+	//Settings is the operation's settings within config
+	Settings(config Config) any
+	//SetSettings replaces the operation's settings within config
+	SetSettings(config *Config, settings any)
+}
+
+// operations is every operation, in the order they are offered by the setup
+// wizard and listed in stats.
+var operations = []Operation{
+	addition{},
+	subtraction{},
+	multiplication{},
+	division{},
+	square{},
+	power{},
+	root{OpSquareRoot, "square roots", 2, "√"},
+	root{OpCubeRoot, "cube roots", 3, "∛"},
+	modulo{},
+	percent{},
+	chain{},
+}
+
+// legacyOperations are the original four, whose settings always count.
+var legacyOperations = []string{"+", "-", "*", "/"}
+
+func lookupOperation(name string) Operation {
+	for _, op := range operations {
+		if op.Name() == name {
+			return op
+		}
+	}
+	return nil
+}
+
+func operationNames() []string {
+	names := make([]string, len(operations))
+	for i, op := range operations {
+		names[i] = op.Name()
+	}
+	return names
+}
+
+func (config Config) enables(name string) bool {
+	return slices.Contains(config.LegalOperations, name)
+}
+
+// checksOperation reports whether an operation's settings matter to config.
+func (config Config) checksOperation(op Operation) bool {
+	return slices.Contains(legacyOperations, op.Name()) || config.enables(op.Name())
+}
+
+const (
+	//defaultWeight is the weight of operations Config.Weights doesn't list
+	defaultWeight = 1
+	//maxWeight keeps the total weight of a config well clear of overflow
+	maxWeight = 1_000_000
+)
+
+// weight is how often op comes up relative to the other enabled operations.
+func (config Config) weight(op string) int {
+	if weight, ok := config.Weights[op]; ok {
+		return weight
+	}
+	return defaultWeight
+}
+
+// pickOperation chooses one of LegalOperations with probability
+// proportional to its weight. An operation listed more than once counts once
+// per listing, as it did before weights existed.
+func (config Config) pickOperation(rng *rand.Rand) string {
+	total := 0
+	for _, op := range config.LegalOperations {
+		total += config.weight(op)
+	}
+	pick := randRange(rng, 0, total-1)
+	for _, op := range config.LegalOperations {
+		if pick < config.weight(op) {
+			return op
+		}
+		pick -= config.weight(op)
+	}
+	return config.LegalOperations[len(config.LegalOperations)-1]
+}
+
+// effectiveWeights drops the weights that make no difference to config:
+// those at the default and those of operations it doesn't enable. It returns
+// nil when none are left.
+func (config Config) effectiveWeights() map[string]int {
+	var weights map[string]int
+	for op, weight := range config.Weights {
+		if weight == defaultWeight || !config.enables(op) {
+			continue
+		}
+		if weights == nil {
+			weights = make(map[string]int)
+		}
+		weights[op] = weight
+	}
+	return weights
+}
+
+// validateWeights checks the weight rules:
+// 1) weights only for known operations
+// 2) weights between 0 and maxWeight
+// 3) at least one enabled operation with a non-zero weight
+func (config Config) validateWeights() []string {
+	var errs []string
+	for _, op := range slices.Sorted(maps.Keys(config.Weights)) {
+		if lookupOperation(op) == nil {
+			errs = append(errs, fmt.Sprintf("WEIGHT FOR UNKNOWN OPERATION %q", op))
+		}
+		if weight := config.Weights[op]; weight < 0 || weight > maxWeight {
+			errs = append(errs, fmt.Sprintf("WEIGHT FOR %q OUTSIDE 0-%d", op, maxWeight))
+		}
+	}
+	total := 0
+	for _, op := range config.LegalOperations {
+		total += max(config.weight(op), 0)
+	}
+	if len(config.LegalOperations) > 0 && total == 0 {
+		errs = append(errs, "EVERY ENABLED OPERATION WEIGHTED ZERO")
+	}
+	return errs
+}
+
+// pairFacts lists every pair of operands in range for operation, or reports
+// false if there are more than limit.
+func pairFacts(operation string, minLeft, maxLeft, minRight, maxRight, limit int) ([]Problem, bool) {
+	lefts, rights := maxLeft-minLeft+1, maxRight-minRight+1
+	if lefts > limit || rights > limit || lefts*rights > limit {
+		return nil, false
+	}
+	var facts []Problem
+	for a := minLeft; a <= maxLeft; a++ {
+		for b := minRight; b <= maxRight; b++ {
+			facts = append(facts, Problem{FirstNum: a, Operation: operation, SecondNum: b})
+		}
+	}
+	return facts, true
+}
+
+// reversed turns problem into the inverse one asking for its first operand,
+// as overridden subtraction and division do.
+func reversed(problem Problem, operation string) Problem {
+	return Problem{FirstNum: getProblemAnswer(problem), Operation: operation, SecondNum: problem.FirstNum}
+}
+
+// reversedFacts reverses every fact in facts, if there are any.
+func reversedFacts(facts []Problem, ok bool, operation string) ([]Problem, bool) {
+	for i, fact := range facts {
+		facts[i] = reversed(fact, operation)
+	}
+	return facts, ok
+}
+
+// fillOperationDefaults gives operations the config has no settings for the
+// zetamac defaults, since configs saved before they existed leave them out.
+// The original four operations are always saved, so they are left alone.
+func fillOperationDefaults(config *Config) {
+	defaults := GetZetamacConfig()
+	for _, op := range operations {
+		if slices.Contains(legacyOperations, op.Name()) {
+			continue
+		}
+		if reflect.ValueOf(op.Settings(*config)).IsZero() {
+			op.SetSettings(config, op.Settings(defaults))
+		}
+	}
+}
+
+// clearUncheckedSettings zeroes the settings of operations that don't matter
+// to config.
+func clearUncheckedSettings(config *Config) {
+	for _, op := range operations {
+		if !config.checksOperation(op) {
+			settings := reflect.TypeOf(op.Settings(*config))
+			op.SetSettings(config, reflect.Zero(settings).Interface())
+		}
+	}
+}
+
+// OperationSettings holds the settings of the operations added after the
+// original four, keyed by operation name, each as the operation's own
+// settings type.
+type OperationSettings map[string]any
+
+// UnmarshalJSON decodes each operation's settings into its settings type.
+// Settings already present are overridden field by field, as for the
+// original four operations' fields.
+func (settings *OperationSettings) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+	updated := maps.Clone(*settings)
+	if updated == nil {
+		updated = make(OperationSettings)
+	}
+	for name, message := range raw {
+		op := lookupOperation(name)
+		if op == nil || slices.Contains(legacyOperations, name) {
+			return fmt.Errorf("settings for unknown operation %q", name)
+		}
+		value := reflect.New(reflect.TypeOf(op.Settings(Config{})))
+		if current, ok := updated[name]; ok {
+			value.Elem().Set(reflect.ValueOf(current))
+		}
+		err = json.Unmarshal(message, value.Interface())
+		if err != nil {
+			return fmt.Errorf("settings for %q: %w", name, err)
+		}
+		updated[name] = value.Elem().Interface()
+	}
+	*settings = updated
+	return nil
+}
+
+// settingsFor returns the settings config holds for operation, or zero
+// settings if it holds none.
+func settingsFor[T any](config Config, operation string) T {
+	settings, _ := config.Settings[operation].(T)
+	return settings
+}
+
+// setSettings replaces the settings of operation, dropping zero settings so
+// they stay out of the saved config. Copies of a Config share Settings, so
+// the map is copied rather than changed in place.
+func (config *Config) setSettings(operation string, settings any) {
+	updated := maps.Clone(config.Settings)
+	if updated == nil {
+		updated = make(OperationSettings)
+	}
+	if reflect.ValueOf(settings).IsZero() {
+		delete(updated, operation)
+	} else {
+		updated[operation] = settings
+	}
+	if len(updated) == 0 {
+		updated = nil
+	}
+	config.Settings = updated
+}
+
+// formatBinary writes problem as "a op b".
+func formatBinary(problem Problem) string {
+	return fmt.Sprintf("%d %s %d", problem.FirstNum, problem.Operation, problem.SecondNum)
+}
+
+// parseBinary reads "a op b" for operation.
+func parseBinary(text string, operation string) (Problem, bool) {
+	parts := strings.Split(text, " ")
+	if len(parts) != 3 || parts[1] != operation {
+		return Problem{}, false
+	}
+	firstNum, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return Problem{}, false
+	}
+	secondNum, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return Problem{}, false
+	}
+	return Problem{FirstNum: firstNum, Operation: operation, SecondNum: secondNum}, true
+}
+
+// parseUnary reads a single operand marked with prefix and suffix, as in √49
+// or 7².
+func parseUnary(text string, prefix string, suffix string, operation string) (Problem, bool) {
+	if !strings.HasPrefix(text, prefix) || !strings.HasSuffix(text, suffix) {
+		return Problem{}, false
+	}
+	firstNum, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(text, prefix), suffix))
+	if err != nil {
+		return Problem{}, false
+	}
+	return Problem{FirstNum: firstNum, Operation: operation}, true
+}
+
+type addition struct{}
+
+func (addition) Name() string     { return "+" }
+func (addition) Describe() string { return "addition" }
+
+func (addition) Generate(rng *rand.Rand, config Config) Problem {
+	return genAdditionProblem(rng, config.AdditionConfig)
+}
+
+func (addition) Facts(config Config, limit int) ([]Problem, bool) {
+	add := config.AdditionConfig
+	return pairFacts("+", add.MinLeft, add.MaxLeft, add.MinRight, add.MaxRight, limit)
+}
+
+func (addition) Answer(problem Problem) (int, error) {
+	a, b := problem.FirstNum, problem.SecondNum
+	if (b > 0 && a > math.MaxInt-b) || (b < 0 && a < math.MinInt-b) {
+		return 0, ErrOverflow
+	}
+	return a + b, nil
+}
+
+func (addition) Format(problem Problem) string { return formatBinary(problem) }
+
+func (addition) Parse(text string) (Problem, bool) { return parseBinary(text, "+") }
+
+// Validate checks the addition rules:
+// 1) operands between -maxint/2 and maxint/2
+// 2) maxes >= mins
+func (addition) Validate(config Config) []string {
+	var errs []string
+	add := config.AdditionConfig
+	if add.MaxLeft >= math.MaxInt/2 || add.MaxRight >= math.MaxInt/2 || add.MinLeft <= math.MinInt/2 || add.MinRight <= math.MinInt/2 {
+		errs = append(errs, "ADDITION OPERANDS LARGER THAN HALF OF MAX INTEGER VALUE")
+	}
+	if add.MaxLeft < add.MinLeft || add.MaxRight < add.MinRight {
+		errs = append(errs, "NO POSSIBLE ADDITION OPERANDS")
+	}
+	return errs
+}
+
+func (addition) Setup(config *Config, reader *bufio.Reader) {
+	setupAdditionConfig(&config.AdditionConfig, reader)
+}
+
+func (addition) Settings(config Config) any { return config.AdditionConfig }
+
+func (addition) SetSettings(config *Config, settings any) {
+	config.AdditionConfig = settings.(AdditionConfig)
+}
+
+type subtraction struct{}
+
+func (subtraction) Name() string     { return "-" }
+func (subtraction) Describe() string { return "subtraction" }
+
+// Generate reverses an addition problem when subtraction is overridden.
+func (subtraction) Generate(rng *rand.Rand, config Config) Problem {
+	if config.OverrideSubtractionConfig {
+		return reversed(genAdditionProblem(rng, config.AdditionConfig), "-")
+	}
+	return genSubtractionProblem(rng, config.SubtractionConfig)
+}
+
+func (subtraction) Facts(config Config, limit int) ([]Problem, bool) {
+	if config.OverrideSubtractionConfig {
+		facts, ok := addition{}.Facts(config, limit)
+		return reversedFacts(facts, ok, "-")
+	}
+	sub := config.SubtractionConfig
+	if !sub.ForceNonnegativeDifference {
+		return pairFacts("-", sub.MinLeft, sub.MaxLeft, sub.MinRight, sub.MaxRight, limit)
+	}
+	var facts []Problem
+	for a := max(sub.MinLeft, sub.MinRight); a <= sub.MaxLeft; a++ {
+		for b := sub.MinRight; b <= min(a, sub.MaxRight); b++ {
+			if len(facts) == limit {
+				return nil, false
+			}
+			facts = append(facts, Problem{FirstNum: a, Operation: "-", SecondNum: b})
+		}
+	}
+	return facts, true
+}
+
+func (subtraction) Answer(problem Problem) (int, error) {
+	a, b := problem.FirstNum, problem.SecondNum
+	if (b < 0 && a > math.MaxInt+b) || (b > 0 && a < math.MinInt+b) {
+		return 0, ErrOverflow
+	}
+	return a - b, nil
+}
+
+func (subtraction) Format(problem Problem) string { return formatBinary(problem) }
+
+func (subtraction) Parse(text string) (Problem, bool) { return parseBinary(text, "-") }
+
+// Validate checks the subtraction rules:
+// 1) operands between -maxint/2 and maxint/2
+// 2) if the option is set, leftmax >= rightmin (so we can always generate difference of at least 0)
+// 3) maxes >= mins
+func (subtraction) Validate(config Config) []string {
+	var errs []string
+	sub := config.SubtractionConfig
+	if sub.MaxLeft >= math.MaxInt/2 || sub.MaxRight >= math.MaxInt/2 || sub.MinLeft <= math.MinInt/2 || sub.MinRight <= math.MinInt/2 {
+		errs = append(errs, "SUBTRACTION OPERANDS LARGER THAN HALF OF MAX INTEGER VALUE")
+	}
+	if sub.ForceNonnegativeDifference && sub.MaxLeft < sub.MinRight {
+		errs = append(errs, "NO POSSIBLE NON-NEGATIVE DIFFERENCES")
+	}
+	if sub.MaxLeft < sub.MinLeft || sub.MaxRight < sub.MinRight {
+		errs = append(errs, "NO POSSIBLE SUBTRACTION OPERANDS")
+	}
+	return errs
+}
+
+func (subtraction) Setup(config *Config, reader *bufio.Reader) {
+	setupSubtractionConfig(&config.SubtractionConfig, reader)
+}
+
+func (subtraction) Settings(config Config) any { return config.SubtractionConfig }
+
+func (subtraction) SetSettings(config *Config, settings any) {
+	config.SubtractionConfig = settings.(SubtractionConfig)
+}
+
+type multiplication struct{}
+
+func (multiplication) Name() string     { return "*" }
+func (multiplication) Describe() string { return "multiplication" }
+
+func (multiplication) Generate(rng *rand.Rand, config Config) Problem {
+	return genMultiplicationProblem(rng, config.MultiplicationConfig)
+}
+
+func (multiplication) Facts(config Config, limit int) ([]Problem, bool) {
+	mult := config.MultiplicationConfig
+	return pairFacts("*", mult.MinLeft, mult.MaxLeft, mult.MinRight, mult.MaxRight, limit)
+}
+
+func (multiplication) Answer(problem Problem) (int, error) {
+	return checkedMul(problem.FirstNum, problem.SecondNum)
+}
+
+func (multiplication) Format(problem Problem) string { return formatBinary(problem) }
+
+func (multiplication) Parse(text string) (Problem, bool) { return parseBinary(text, "*") }
+
+// Validate checks the multiplication rules:
+// 1) no non-positive operands
+// 2) operands less than sqrt(maxint)
+// 3) maxes >= mins
+func (multiplication) Validate(config Config) []string {
+	var errs []string
+	mult := config.MultiplicationConfig
+	if mult.MinLeft <= 0 || mult.MinRight <= 0 {
+		errs = append(errs, "NON-POSITIVE MULTIPLICATION OPERANDS")
+	}
+	if mult.MaxLeft >= int(math.Sqrt(math.MaxInt)) || mult.MaxRight >= int(math.Sqrt(math.MaxInt/2)) {
+		errs = append(errs, "MULTIPLICATION OPERANDS GREATER THAN SQUARE ROOT OF MAX INTEGER VALUE")
+	}
+	if mult.MaxLeft < mult.MinLeft || mult.MaxRight < mult.MinRight {
+		errs = append(errs, "NO POSSIBLE MULTIPLICATION OPERANDS")
+	}
+	return errs
+}
+
+func (multiplication) Setup(config *Config, reader *bufio.Reader) {
+	setupMultiplicationConfig(&config.MultiplicationConfig, reader)
+}
+
+func (multiplication) Settings(config Config) any { return config.MultiplicationConfig }
+
+func (multiplication) SetSettings(config *Config, settings any) {
+	config.MultiplicationConfig = settings.(MultiplicationConfig)
+}
+
+type division struct{}
+
+func (division) Name() string     { return "/" }
+func (division) Describe() string { return "division" }
+
+// Generate reverses a multiplication problem when division is overridden.
+func (division) Generate(rng *rand.Rand, config Config) Problem {
+	if config.OverrideDivisionConfig {
+		return reversed(genMultiplicationProblem(rng, config.MultiplicationConfig), "/")
+	}
+	return genDivisionProblem(rng, config.DivisionConfig)
+}
+
+func (division) Facts(config Config, limit int) ([]Problem, bool) {
+	if config.OverrideDivisionConfig {
+		facts, ok := multiplication{}.Facts(config, limit)
+		return reversedFacts(facts, ok, "/")
+	}
+	div := config.DivisionConfig
+	if !div.ForceCleanDivision {
+		return pairFacts("/", div.MinLeft, div.MaxLeft, div.MinRight, div.MaxRight, limit)
+	}
+	if div.cleanDivisions() > limit {
+		return nil, false
+	}
+	var facts []Problem
+	for _, run := range div.cleanDivisors() {
+		for divisor := run.First; divisor <= run.Last; divisor++ {
+			for quotient := (div.MinLeft-1)/divisor + 1; quotient <= div.MaxLeft/divisor; quotient++ {
+				facts = append(facts, Problem{FirstNum: divisor * quotient, Operation: "/", SecondNum: divisor})
+			}
+		}
+	}
+	return facts, true
+}
+
+// Answer truncates toward zero when the division doesn't come out clean, so
+// 7 / 2 is 3 and -7 / 2 is -3.
+func (division) Answer(problem Problem) (int, error) {
+	a, b := problem.FirstNum, problem.SecondNum
+	if b == 0 {
+		return 0, ErrDivisionByZero
+	}
+	if a == math.MinInt && b == -1 {
+		return 0, ErrOverflow
+	}
+	return a / b, nil
+}
+
+func (division) Format(problem Problem) string { return formatBinary(problem) }
+
+func (division) Parse(text string) (Problem, bool) { return parseBinary(text, "/") }
+
+// Validate checks the division rules:
+// 1) no non-positive operands
+// 2) leftmax >= rightmin (so we can always generate quotient of at least 1)
+// 3) maxes >= mins
+// 4) a known answer mode, with 1 to maxDecimalPlaces places for decimals
+// 5) if the option is set, dividends up to maxCleanDividend and at least one
+// clean division
+// 6) answers no longer than maxAnswerLength
+func (division) Validate(config Config) []string {
+	var errs []string
+	div := config.DivisionConfig
+	if div.MinLeft <= 0 || div.MinRight <= 0 {
+		errs = append(errs, "NON-POSITIVE DIVISION OPERANDS")
+	}
+	if div.MaxLeft < div.MinRight {
+		errs = append(errs, "NO POSSIBLE NON-ZERO QUOTIENTS")
+	}
+	if div.MaxLeft < div.MinLeft || div.MaxRight < div.MinRight {
+		errs = append(errs, "NO POSSIBLE DIVISION OPERANDS")
+	}
+	switch div.AnswerMode {
+	case "", DivisionInteger, DivisionRemainder:
+	case DivisionDecimal:
+		if div.DecimalPlaces < 1 || div.DecimalPlaces > maxDecimalPlaces {
+			errs = append(errs, fmt.Sprintf("DECIMAL PLACES OUTSIDE 1-%d", maxDecimalPlaces))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("UNKNOWN DIVISION ANSWER MODE %q", div.AnswerMode))
+	}
+	if div.ForceCleanDivision && div.MaxLeft > maxCleanDividend {
+		errs = append(errs, fmt.Sprintf("CLEAN DIVISION DIVIDENDS LARGER THAN %d", maxCleanDividend))
+	}
+	if div.ForceCleanDivision && len(errs) == 0 && div.cleanDivisions() == 0 {
+		errs = append(errs, "NO POSSIBLE CLEAN DIVISIONS")
+	}
+	if len(errs) == 0 && div.longestAnswer() > maxAnswerLength {
+		errs = append(errs, fmt.Sprintf("DIVISION ANSWERS LONGER THAN %d CHARACTERS", maxAnswerLength))
+	}
+	return errs
+}
+
+func (division) Setup(config *Config, reader *bufio.Reader) {
+	setupDivisionConfig(&config.DivisionConfig, reader)
+}
+
+func (division) Settings(config Config) any { return config.DivisionConfig }
+
+func (division) SetSettings(config *Config, settings any) {
+	config.DivisionConfig = settings.(DivisionConfig)
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// Operations beyond the four basic ones. Square and the roots only use
+// FirstNum of a Problem.
+const (
+	OpSquare     = "sq"
+	OpPower      = "^"
+	OpSquareRoot = "sqrt"
+	OpCubeRoot   = "cbrt"
+	OpModulo     = "mod"
+	OpPercent    = "%"
+)
+
+type SquareConfig struct {
+	Min int
+	Max int
+}
+
+func (config SquareConfig) String() string {
+	return fmt.Sprintf("%d-%d", config.Min, config.Max)
+}
+
+type PowerConfig struct {
+	MinBase     int
+	MaxBase     int
+	MinExponent int
+	MaxExponent int
+}
+
+func (config PowerConfig) String() string {
+	return fmt.Sprintf("%d-%d\t%d-%d", config.MinBase, config.MaxBase, config.MinExponent, config.MaxExponent)
+}
+
+// RootConfig is the range of answers to root problems, so every root
+// problem comes out clean.
+type RootConfig struct {
+	Min int
+	Max int
+}
+
+func (config RootConfig) String() string {
+	return fmt.Sprintf("%d-%d", config.Min, config.Max)
+}
+
+type ModuloConfig struct {
+	MinLeft  int
+	MaxLeft  int
+	MinRight int
+	MaxRight int
+}
+
+func (config ModuloConfig) String() string {
+	return fmt.Sprintf("%d-%d\t%d-%d", config.MinLeft, config.MaxLeft, config.MinRight, config.MaxRight)
+}
+
+// PercentConfig ranges "x% of y" problems. Only pairs whose answer is a
+// whole number are generated.
+type PercentConfig struct {
+	MinPercent int
+	MaxPercent int
+	MinBase    int
+	MaxBase    int
+}
+
+func (config PercentConfig) String() string {
+	return fmt.Sprintf("%d-%d%%\t%d-%d", config.MinPercent, config.MaxPercent, config.MinBase, config.MaxBase)
+}
+
+func genSquareProblem(rng *rand.Rand, config SquareConfig) Problem {
+	return Problem{FirstNum: randRange(rng, config.Min, config.Max), Operation: OpSquare}
+}
+
+func genPowerProblem(rng *rand.Rand, config PowerConfig) Problem {
+	var problem Problem
+	problem.Operation = OpPower
+	problem.FirstNum = randRange(rng, config.MinBase, config.MaxBase)
+	problem.SecondNum = randRange(rng, config.MinExponent, config.MaxExponent)
+	return problem
+}
+
+// genRootProblem picks the answer first and asks for the root of its square
+// or cube.
+func genRootProblem(rng *rand.Rand, config RootConfig, operation string) Problem {
+	return rootProblem(randRange(rng, config.Min, config.Max), operation)
+}
+
+// rootProblem asks for root back from its square or cube.
+func rootProblem(root int, operation string) Problem {
+	power := root * root
+	if operation == OpCubeRoot {
+		power *= root
+	}
+	return Problem{FirstNum: power, Operation: operation}
+}
+
+func genModuloProblem(rng *rand.Rand, config ModuloConfig) Problem {
+	var problem Problem
+	problem.Operation = OpModulo
+	problem.FirstNum = randRange(rng, config.MinLeft, config.MaxLeft)
+	problem.SecondNum = randRange(rng, config.MinRight, config.MaxRight)
+	return problem
+}
+
+// percentBases returns the range of multipliers k for which k*step is a base
+// in the config's range, where step is the smallest base that gives percent
+// a whole answer.
+func (config PercentConfig) percentBases(percent int) (step int, lo int, hi int) {
+	step = 100 / gcd(percent, 100)
+	lo = (config.MinBase + step - 1) / step
+	hi = config.MaxBase / step
+	return step, lo, hi
+}
+
+// genPercentProblem picks uniformly among the percents in range that have a
+// whole answer, then among their bases.
+func genPercentProblem(rng *rand.Rand, config PercentConfig) Problem {
+	//validateConfig makes sure some percent in range has a whole answer
+	percents, counts := config.wholePercents()
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	pick := randRange(rng, 0, total-1)
+	percent := percents[len(percents)-1]
+	for i, count := range counts {
+		if pick < count {
+			percent = percents[i] + 100*pick
+			break
+		}
+		pick -= count
+	}
+	step, lo, hi := config.percentBases(percent)
+	return Problem{FirstNum: percent, Operation: OpPercent, SecondNum: randRange(rng, lo, hi) * step}
+}
+
+// wholePercents lists the percents among the first hundred in range that
+// have a base in range giving a whole answer, and for each how many percents
+// in range share its bases. Which bases work only depends on the percent
+// modulo 100, so the percents sharing bases are 100 apart.
+func (config PercentConfig) wholePercents() (percents []int, counts []int) {
+	for percent := config.MinPercent; percent <= config.MaxPercent && percent < config.MinPercent+100; percent++ {
+		_, lo, hi := config.percentBases(percent)
+		if lo <= hi {
+			percents = append(percents, percent)
+			counts = append(counts, (config.MaxPercent-percent)/100+1)
+		}
+	}
+	return percents, counts
+}
+
+// tooLongToType reports whether answer has more characters than the player
+// can type.
+func tooLongToType(answer int) bool {
+	return len(strconv.Itoa(answer)) > maxAnswerLength
+}
+
+func gcd(a int, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+type square struct{}
+
+func (square) Name() string     { return OpSquare }
+func (square) Describe() string { return "squaring" }
+
+func (square) Generate(rng *rand.Rand, config Config) Problem {
+	return genSquareProblem(rng, settingsFor[SquareConfig](config, OpSquare))
+}
+
+func (square) Facts(config Config, limit int) ([]Problem, bool) {
+	settings := settingsFor[SquareConfig](config, OpSquare)
+	if settings.Max-settings.Min+1 > limit {
+		return nil, false
+	}
+	var facts []Problem
+	for n := settings.Min; n <= settings.Max; n++ {
+		facts = append(facts, Problem{FirstNum: n, Operation: OpSquare})
+	}
+	return facts, true
+}
+
+func (square) Answer(problem Problem) (int, error) {
+	return checkedMul(problem.FirstNum, problem.FirstNum)
+}
+
+func (square) Format(problem Problem) string { return fmt.Sprintf("%d²", problem.FirstNum) }
+
+func (square) Parse(text string) (Problem, bool) { return parseUnary(text, "", "²", OpSquare) }
+
+// Validate checks the square rules:
+// 1) no negative operands
+// 2) squares less than max integer value and no longer than maxAnswerLength
+// 3) max >= min
+func (square) Validate(config Config) []string {
+	var errs []string
+	sq := settingsFor[SquareConfig](config, OpSquare)
+	if sq.Min < 0 {
+		errs = append(errs, "NEGATIVE SQUARE OPERANDS")
+	}
+	if largest, err := checkedMul(sq.Max, sq.Max); err != nil {
+		errs = append(errs, "SQUARES GREATER THAN MAX INTEGER VALUE")
+	} else if tooLongToType(largest) {
+		errs = append(errs, fmt.Sprintf("SQUARES LONGER THAN %d DIGITS", maxAnswerLength))
+	}
+	if sq.Max < sq.Min {
+		errs = append(errs, "NO POSSIBLE SQUARE OPERANDS")
+	}
+	return errs
+}
+
+func (square) Setup(config *Config, reader *bufio.Reader) {
+	settings := settingsFor[SquareConfig](*config, OpSquare)
+	setupSquareConfig(&settings, reader)
+	config.setSettings(OpSquare, settings)
+}
+
+func (square) Settings(config Config) any { return settingsFor[SquareConfig](config, OpSquare) }
+
+func (square) SetSettings(config *Config, settings any) { config.setSettings(OpSquare, settings) }
+
+type power struct{}
+
+func (power) Name() string     { return OpPower }
+func (power) Describe() string { return "powers" }
+
+func (power) Generate(rng *rand.Rand, config Config) Problem {
+	return genPowerProblem(rng, settingsFor[PowerConfig](config, OpPower))
+}
+
+func (power) Facts(config Config, limit int) ([]Problem, bool) {
+	settings := settingsFor[PowerConfig](config, OpPower)
+	return pairFacts(OpPower, settings.MinBase, settings.MaxBase, settings.MinExponent, settings.MaxExponent, limit)
+}
+
+func (power) Answer(problem Problem) (int, error) {
+	return checkedPow(problem.FirstNum, problem.SecondNum)
+}
+
+func (power) Format(problem Problem) string { return formatBinary(problem) }
+
+func (power) Parse(text string) (Problem, bool) { return parseBinary(text, OpPower) }
+
+// Validate checks the power rules:
+// 1) no negative bases or exponents
+// 2) powers less than max integer value and no longer than maxAnswerLength
+// 3) maxes >= mins
+func (power) Validate(config Config) []string {
+	var errs []string
+	pow := settingsFor[PowerConfig](config, OpPower)
+	if pow.MinBase < 0 || pow.MinExponent < 0 {
+		errs = append(errs, "NEGATIVE POWER OPERANDS")
+	}
+	if largest, err := checkedPow(pow.MaxBase, pow.MaxExponent); err != nil {
+		errs = append(errs, "POWERS GREATER THAN MAX INTEGER VALUE")
+	} else if tooLongToType(largest) {
+		errs = append(errs, fmt.Sprintf("POWERS LONGER THAN %d DIGITS", maxAnswerLength))
+	}
+	if pow.MaxBase < pow.MinBase || pow.MaxExponent < pow.MinExponent {
+		errs = append(errs, "NO POSSIBLE POWER OPERANDS")
+	}
+	return errs
+}
+
+func (power) Setup(config *Config, reader *bufio.Reader) {
+	settings := settingsFor[PowerConfig](*config, OpPower)
+	setupPowerConfig(&settings, reader)
+	config.setSettings(OpPower, settings)
+}
+
+func (power) Settings(config Config) any { return settingsFor[PowerConfig](config, OpPower) }
+
+func (power) SetSettings(config *Config, settings any) { config.setSettings(OpPower, settings) }
+
+// root is square or cube roots, told apart by the power they undo and the
+// symbol they're written with.
+type root struct {
+	name     string
+	describe string
+	power    int
+	symbol   string
+}
+
+func (op root) Name() string     { return op.name }
+func (op root) Describe() string { return op.describe }
+
+func (op root) Generate(rng *rand.Rand, config Config) Problem {
+	return genRootProblem(rng, settingsFor[RootConfig](config, op.name), op.name)
+}
+
+func (op root) Facts(config Config, limit int) ([]Problem, bool) {
+	settings := settingsFor[RootConfig](config, op.name)
+	if settings.Max-settings.Min+1 > limit {
+		return nil, false
+	}
+	var facts []Problem
+	for root := settings.Min; root <= settings.Max; root++ {
+		facts = append(facts, rootProblem(root, op.name))
+	}
+	return facts, true
+}
+
+// Answer truncates roots of numbers that aren't perfect powers. Cube roots
+// of negative numbers are negative.
+func (op root) Answer(problem Problem) (int, error) {
+	a := problem.FirstNum
+	if a < 0 && op.power%2 == 0 {
+		return 0, ErrNegativeRoot
+	}
+	if a == math.MinInt {
+		return 0, ErrOverflow
+	}
+	if a < 0 {
+		return -intRoot(-a, op.power), nil
+	}
+	return intRoot(a, op.power), nil
+}
+
+func (op root) Format(problem Problem) string { return op.symbol + strconv.Itoa(problem.FirstNum) }
+
+func (op root) Parse(text string) (Problem, bool) { return parseUnary(text, op.symbol, "", op.name) }
+
+// Validate checks the root rules:
+// 1) no negative roots
+// 2) powers of the roots less than max integer value
+// 3) maxes >= mins
+func (op root) Validate(config Config) []string {
+	var errs []string
+	settings := settingsFor[RootConfig](config, op.name)
+	name := strings.ToUpper(strings.TrimSuffix(op.describe, "s"))
+	if settings.Min < 0 {
+		errs = append(errs, fmt.Sprintf("NEGATIVE %sS", name))
+	}
+	if _, err := checkedPow(settings.Max, op.power); err != nil {
+		errs = append(errs, fmt.Sprintf("%s OPERANDS GREATER THAN MAX INTEGER VALUE", name))
+	}
+	if settings.Max < settings.Min {
+		errs = append(errs, fmt.Sprintf("NO POSSIBLE %sS", name))
+	}
+	return errs
+}
+
+func (op root) Setup(config *Config, reader *bufio.Reader) {
+	settings := settingsFor[RootConfig](*config, op.name)
+	setupRootConfig(&settings, reader)
+	config.setSettings(op.name, settings)
+}
+
+func (op root) Settings(config Config) any { return settingsFor[RootConfig](config, op.name) }
+
+func (op root) SetSettings(config *Config, settings any) { config.setSettings(op.name, settings) }
+
+type modulo struct{}
+
+func (modulo) Name() string     { return OpModulo }
+func (modulo) Describe() string { return "modulo" }
+
+func (modulo) Generate(rng *rand.Rand, config Config) Problem {
+	return genModuloProblem(rng, settingsFor[ModuloConfig](config, OpModulo))
+}
+
+func (modulo) Facts(config Config, limit int) ([]Problem, bool) {
+	settings := settingsFor[ModuloConfig](config, OpModulo)
+	return pairFacts(OpModulo, settings.MinLeft, settings.MaxLeft, settings.MinRight, settings.MaxRight, limit)
+}
+
+func (modulo) Answer(problem Problem) (int, error) {
+	if problem.SecondNum == 0 {
+		return 0, ErrDivisionByZero
+	}
+	return problem.FirstNum % problem.SecondNum, nil
+}
+
+func (modulo) Format(problem Problem) string { return formatBinary(problem) }
+
+func (modulo) Parse(text string) (Problem, bool) { return parseBinary(text, OpModulo) }
+
+// Validate checks the modulo rules:
+// 1) no negative operands and no zero modulus
+// 2) maxes >= mins
+func (modulo) Validate(config Config) []string {
+	var errs []string
+	mod := settingsFor[ModuloConfig](config, OpModulo)
+	if mod.MinLeft < 0 || mod.MinRight <= 0 {
+		errs = append(errs, "NON-POSITIVE MODULO OPERANDS")
+	}
+	if mod.MaxLeft < mod.MinLeft || mod.MaxRight < mod.MinRight {
+		errs = append(errs, "NO POSSIBLE MODULO OPERANDS")
+	}
+	return errs
+}
+
+func (modulo) Setup(config *Config, reader *bufio.Reader) {
+	settings := settingsFor[ModuloConfig](*config, OpModulo)
+	setupModuloConfig(&settings, reader)
+	config.setSettings(OpModulo, settings)
+}
+
+func (modulo) Settings(config Config) any { return settingsFor[ModuloConfig](config, OpModulo) }
+
+func (modulo) SetSettings(config *Config, settings any) { config.setSettings(OpModulo, settings) }
+
+type percent struct{}
+
+func (percent) Name() string     { return OpPercent }
+func (percent) Describe() string { return "percentages" }
+
+func (percent) Generate(rng *rand.Rand, config Config) Problem {
+	return genPercentProblem(rng, settingsFor[PercentConfig](config, OpPercent))
+}
+
+func (percent) Facts(config Config, limit int) ([]Problem, bool) {
+	settings := settingsFor[PercentConfig](config, OpPercent)
+	if settings.MaxPercent-settings.MinPercent+1 > limit {
+		return nil, false
+	}
+	var facts []Problem
+	for percent := settings.MinPercent; percent <= settings.MaxPercent; percent++ {
+		step, lo, hi := settings.percentBases(percent)
+		for k := lo; k <= hi; k++ {
+			if len(facts) == limit {
+				return nil, false
+			}
+			facts = append(facts, Problem{FirstNum: percent, Operation: OpPercent, SecondNum: k * step})
+		}
+	}
+	return facts, true
+}
+
+// Answer truncates percentages that don't come out whole.
+func (percent) Answer(problem Problem) (int, error) {
+	res, err := checkedMul(problem.FirstNum, problem.SecondNum)
+	return res / 100, err
+}
+
+func (percent) Format(problem Problem) string {
+	return fmt.Sprintf("%d%% of %d", problem.FirstNum, problem.SecondNum)
+}
+
+// Parse reads "x% of y", which puts the operation on the first operand.
+func (percent) Parse(text string) (Problem, bool) {
+	parts := strings.Split(text, " ")
+	if len(parts) != 3 || parts[1] != "of" || !strings.HasSuffix(parts[0], "%") {
+		return Problem{}, false
+	}
+	firstNum, err := strconv.Atoi(strings.TrimSuffix(parts[0], "%"))
+	if err != nil {
+		return Problem{}, false
+	}
+	secondNum, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return Problem{}, false
+	}
+	return Problem{FirstNum: firstNum, Operation: OpPercent, SecondNum: secondNum}, true
+}
+
+// Validate checks the percent rules:
+// 1) no non-positive operands
+// 2) products less than max integer value, and answers no longer than
+// maxAnswerLength
+// 3) maxes >= mins
+// 4) some percent in range has a whole answer for some base in range
+func (percent) Validate(config Config) []string {
+	var errs []string
+	pct := settingsFor[PercentConfig](config, OpPercent)
+	if pct.MinPercent <= 0 || pct.MinBase <= 0 {
+		errs = append(errs, "NON-POSITIVE PERCENT OPERANDS")
+	}
+	if product, err := checkedMul(pct.MaxPercent, pct.MaxBase); err != nil {
+		errs = append(errs, "PERCENT PRODUCTS GREATER THAN MAX INTEGER VALUE")
+	} else if tooLongToType(product / 100) {
+		errs = append(errs, fmt.Sprintf("PERCENTAGES LONGER THAN %d DIGITS", maxAnswerLength))
+	}
+	if pct.MaxPercent < pct.MinPercent || pct.MaxBase < pct.MinBase {
+		errs = append(errs, "NO POSSIBLE PERCENT OPERANDS")
+	} else if percents, _ := pct.wholePercents(); len(percents) == 0 {
+		errs = append(errs, "NO PERCENT OPERANDS WITH A WHOLE ANSWER")
+	}
+	return errs
+}
+
+func (percent) Setup(config *Config, reader *bufio.Reader) {
+	settings := settingsFor[PercentConfig](*config, OpPercent)
+	setupPercentConfig(&settings, reader)
+	config.setSettings(OpPercent, settings)
+}
+
+func (percent) Settings(config Config) any { return settingsFor[PercentConfig](config, OpPercent) }
+
+func (percent) SetSettings(config *Config, settings any) { config.setSettings(OpPercent, settings) }
+
+func setIntByInput(input string, option *int) {
+	num, err := strconv.Atoi(input)
+	if err == nil && len(input) > 0 {
+		*option = num
+	}
+}
+
+func setupSquareConfig(config *SquareConfig, reader *bufio.Reader) {
+	fmt.Printf("\r\nSmallest number to square [%d]: ", config.Min)
+	setIntByInput(getCleanInput(reader), &config.Min)
+	fmt.Printf("\r\nLargest number to square [%d]: ", config.Max)
+	setIntByInput(getCleanInput(reader), &config.Max)
+}
+
+func setupPowerConfig(config *PowerConfig, reader *bufio.Reader) {
+	fmt.Printf("\r\nSmallest base [%d]: ", config.MinBase)
+	setIntByInput(getCleanInput(reader), &config.MinBase)
+	fmt.Printf("\r\nLargest base [%d]: ", config.MaxBase)
+	setIntByInput(getCleanInput(reader), &config.MaxBase)
+	fmt.Printf("\r\nSmallest exponent [%d]: ", config.MinExponent)
+	setIntByInput(getCleanInput(reader), &config.MinExponent)
+	fmt.Printf("\r\nLargest exponent [%d]: ", config.MaxExponent)
+	setIntByInput(getCleanInput(reader), &config.MaxExponent)
+}
+
+func setupRootConfig(config *RootConfig, reader *bufio.Reader) {
+	fmt.Printf("\r\nSmallest root [%d]: ", config.Min)
+	setIntByInput(getCleanInput(reader), &config.Min)
+	fmt.Printf("\r\nLargest root [%d]: ", config.Max)
+	setIntByInput(getCleanInput(reader), &config.Max)
+}
+
+func setupModuloConfig(config *ModuloConfig, reader *bufio.Reader) {
+	fmt.Printf("\r\nSmallest left number [%d]: ", config.MinLeft)
+	setIntByInput(getCleanInput(reader), &config.MinLeft)
+	fmt.Printf("\r\nLargest left number [%d]: ", config.MaxLeft)
+	setIntByInput(getCleanInput(reader), &config.MaxLeft)
+	fmt.Printf("\r\nSmallest modulus [%d]: ", config.MinRight)
+	setIntByInput(getCleanInput(reader), &config.MinRight)
+	fmt.Printf("\r\nLargest modulus [%d]: ", config.MaxRight)
+	setIntByInput(getCleanInput(reader), &config.MaxRight)
+}
+
+func setupPercentConfig(config *PercentConfig, reader *bufio.Reader) {
+	fmt.Printf("\r\nSmallest percentage [%d]: ", config.MinPercent)
+	setIntByInput(getCleanInput(reader), &config.MinPercent)
+	fmt.Printf("\r\nLargest percentage [%d]: ", config.MaxPercent)
+	setIntByInput(getCleanInput(reader), &config.MaxPercent)
+	fmt.Printf("\r\nSmallest number to take a percentage of [%d]: ", config.MinBase)
+	setIntByInput(getCleanInput(reader), &config.MinBase)
+	fmt.Printf("\r\nLargest number to take a percentage of [%d]: ", config.MaxBase)
+	setIntByInput(getCleanInput(reader), &config.MaxBase)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HomeEnv overrides where zetatrack keeps its files. Scores and configs both
+// live under it, like the --data-dir flag.
+const HomeEnv = "ZETATRACK_HOME"
+
+// Paths says where zetatrack's files live. Scores and practice state go in
+// DataDir, saved configs in ConfigDir.
+type Paths struct {
+	DataDir   string
+	ConfigDir string
+}
+
+func (paths Paths) Scores() string {
+	return filepath.Join(paths.DataDir, "scores.txt")
+}
+
+func (paths Paths) Config(name string) string {
+	return filepath.Join(paths.ConfigDir, name+".txt")
+}
+
+// resolvePaths picks the data and config directories. An explicit override,
+// from the --data-dir flag or ZETATRACK_HOME, holds everything; otherwise
+// scores follow XDG_DATA_HOME and configs XDG_CONFIG_HOME, defaulting to
+// ~/.local/share/zetatrack and ~/.config/zetatrack.
+func resolvePaths(override string) (Paths, error) {
+	if len(override) == 0 {
+		override = os.Getenv(HomeEnv)
+	}
+	if len(override) > 0 {
+		return Paths{DataDir: override, ConfigDir: filepath.Join(override, "configs")}, nil
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(dataHome) || !filepath.IsAbs(configHome) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Paths{}, fmt.Errorf("can't find a data directory, set %s: %w", HomeEnv, err)
+		}
+		//the XDG spec says relative paths are invalid and should be ignored
+		if !filepath.IsAbs(dataHome) {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+		if !filepath.IsAbs(configHome) {
+			configHome = filepath.Join(home, ".config")
+		}
+	}
+	return Paths{
+		DataDir:   filepath.Join(dataHome, "zetatrack"),
+		ConfigDir: filepath.Join(configHome, "zetatrack", "configs"),
+	}, nil
+}
+
+// migrateWorkingDirFiles moves scores, practice state and configs left in
+// dir by older versions, which kept everything relative to the working
+// directory, into paths. It only runs while the data directory doesn't exist
+// yet, so once, and only moves files zetatrack can read. Files already
+// present in paths are never replaced, and a file that can't be moved
+// doesn't stop the others.
+func migrateWorkingDirFiles(dir string, paths Paths) error {
+	if fileExists(paths.DataDir) {
+		return nil
+	}
+	moves := make(map[string]string)
+	if scores := filepath.Join(dir, "scores.txt"); isScoreLog(scores) {
+		moves[scores] = paths.Scores()
+	}
+	if deck := filepath.Join(dir, "srs.json"); isDeckFile(deck) {
+		moves[deck] = srsPath(paths.Scores())
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, "configs"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range entries {
+		config := filepath.Join(dir, "configs", entry.Name())
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".txt") && isConfigFile(config) {
+			moves[config] = filepath.Join(paths.ConfigDir, entry.Name())
+		}
+	}
+
+	var errs []error
+	for from, to := range moves {
+		if fileExists(to) || sameFile(from, to) {
+			continue
+		}
+		err := moveFile(from, to)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("Moved %s to %s\r\n", from, to)
+	}
+	//the data directory marks the migration as done, even with nothing moved
+	errs = append(errs, os.MkdirAll(paths.DataDir, 0755))
+	return errors.Join(errs...)
+}
+
+// isScoreLog reports whether path is a score log with every line readable.
+func isScoreLog(path string) bool {
+	logs, err := readLogs(path)
+	return err == nil && len(logs) > 0
+}
+
+// isDeckFile reports whether path is a practice deck with cards in it.
+func isDeckFile(path string) bool {
+	var deck Deck
+	return decodeStrict(path, &deck) && len(deck.Cards) > 0
+}
+
+// isConfigFile reports whether path is a saved config enabling operations.
+func isConfigFile(path string) bool {
+	var config Config
+	return decodeStrict(path, &config) && len(config.LegalOperations) > 0
+}
+
+// decodeStrict reports whether path holds JSON for v and nothing else.
+func decodeStrict(path string, v any) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v) == nil && !decoder.More()
+}
+
+func sameFile(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// moveFile renames from to to, falling back to copy and delete when they
+// are on different filesystems.
+func moveFile(from string, to string) error {
+	err := os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return err
+	}
+	if os.Rename(from, to) == nil {
+		return nil
+	}
+
+	res, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(to, res)
+	if err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// preset is a built-in config, selectable by name like a saved one. A saved
+// config of the same name takes precedence.
+type preset struct {
+	name    string
+	summary string
+	config  func() Config
+}
+
+var presets = []preset{
+	{"zetamac", "the classic zetamac game", zetamacPreset},
+	{"hard", "zetamac with three digit sums and two digit products", hardPreset},
+	{"times-tables", "every times table from 1 to 12, dealt once each", timesTablesPreset},
+	{"division-drill", "clean division of up to three digits by 2 to 19", divisionDrillPreset},
+	{"squares-and-roots", "squares and square roots up to 30", squaresAndRootsPreset},
+}
+
+func zetamacPreset() Config {
+	config := GetZetamacConfig()
+	config.Name = "zetamac"
+	return config
+}
+
+func hardPreset() Config {
+	config := GetZetamacConfig()
+	config.Name = "hard"
+	config.AdditionConfig = AdditionConfig{10, 999, 10, 999}
+	config.MultiplicationConfig = MultiplicationConfig{2, 99, 2, 99}
+	config.NoRepeatWindow = 20
+	return config
+}
+
+func timesTablesPreset() Config {
+	config := GetZetamacConfig()
+	config.Name = "times-tables"
+	config.LegalOperations = []string{"*"}
+	config.MultiplicationConfig = MultiplicationConfig{1, 12, 1, 12}
+	config.DeckMode = true
+	return config
+}
+
+func divisionDrillPreset() Config {
+	config := GetZetamacConfig()
+	config.Name = "division-drill"
+	config.LegalOperations = []string{"/"}
+	config.OverrideDivisionConfig = false
+	config.DivisionConfig = DivisionConfig{10, 999, 2, 19, true, "", 0}
+	config.NoRepeatWindow = 10
+	return config
+}
+
+func squaresAndRootsPreset() Config {
+	config := GetZetamacConfig()
+	config.Name = "squares-and-roots"
+	config.LegalOperations = []string{OpSquare, OpSquareRoot}
+	config.NoRepeatWindow = 5
+	return config
+}
+
+func lookupPreset(name string) (Config, bool) {
+	for _, preset := range presets {
+		if preset.name == name {
+			return preset.config(), true
+		}
+	}
+	return Config{}, false
+}
+
+func presetNames() []string {
+	names := make([]string, len(presets))
+	for i, preset := range presets {
+		names[i] = preset.name
+	}
+	return names
+}
+
+// loadConfigFile reads the config at path. A config that extends another
+// starts from that one, a saved config in the same directory or else a
+// preset, and overrides only the fields it sets. Nested settings override
+// field by field, so {"MultiplicationConfig": {"MaxLeft": 20}} keeps the
+// rest of the multiplication settings. Operations the config has no settings
+// for get the defaults. seen lists the configs already being loaded, to catch
+// configs that end up extending themselves.
+func loadConfigFile(path string, seen []string) (Config, error) {
+	res, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+	var header struct {
+		Name    string
+		Extends string
+	}
+	err = json.Unmarshal(res, &header)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var config Config
+	if len(header.Extends) > 0 {
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		config, err = resolveConfig(filepath.Dir(path), header.Extends, append(seen, name))
+		if err != nil {
+			return Config{}, err
+		}
+		if len(header.Name) == 0 {
+			config.Name = name
+		}
+	}
+	err = json.Unmarshal(res, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	fillOperationDefaults(&config)
+	return config, nil
+}
+
+// resolveConfig finds the config called name for a config to extend. A
+// saved config extending its own name extends the preset it shadows.
+func resolveConfig(dir string, name string, seen []string) (Config, error) {
+	if name == seen[len(seen)-1] {
+		if config, ok := lookupPreset(name); ok {
+			return config, nil
+		}
+	}
+	if slices.Contains(seen, name) {
+		return Config{}, fmt.Errorf("config inheritance cycle: %s -> %s", strings.Join(seen, " -> "), name)
+	}
+	path := filepath.Join(dir, name+".txt")
+	if fileExists(path) {
+		return loadConfigFile(path, seen)
+	}
+	if config, ok := lookupPreset(name); ok {
+		return config, nil
+	}
+	return Config{}, fmt.Errorf("%s extends unknown config %q, not saved or one of the presets %s", seen[len(seen)-1], name, strings.Join(presetNames(), ", "))
+}
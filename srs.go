@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Card is the SM-2 scheduling state of a single fact.
+type Card struct {
+	Problem     Problem
+	Config      string
+	Ease        float64
+	Interval    int
+	Repetitions int
+	Due         time.Time
+}
+
+type Deck struct {
+	Cards map[string]*Card
+}
+
+func srsPath(scoresPath string) string {
+	return filepath.Join(filepath.Dir(scoresPath), "srs.json")
+}
+
+// LoadDeck reads the deck at path. A missing deck is just empty.
+func LoadDeck(path string) (Deck, error) {
+	deck := Deck{Cards: make(map[string]*Card)}
+	res, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return deck, nil
+	}
+	if err != nil {
+		return Deck{}, err
+	}
+	err = json.Unmarshal(res, &deck)
+	if err != nil {
+		return Deck{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if deck.Cards == nil {
+		deck.Cards = make(map[string]*Card)
+	}
+	//decks from before cards were kept per config are keyed by fact alone
+	for key, card := range deck.Cards {
+		if rekeyed := cardKey(card.Config, card.Problem); rekeyed != key {
+			delete(deck.Cards, key)
+			deck.Cards[rekeyed] = card
+		}
+	}
+	return deck, nil
+}
+
+// cardKey identifies a fact's card in the schedule of a config, so a fact
+// practised under two configs has a card in each.
+func cardKey(config string, problem Problem) string {
+	return config + "|" + problem.String()
+}
+
+func (deck Deck) Save(path string) error {
+	res, err := json.MarshalIndent(deck, "", "\t")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, res)
+}
+
+// Due lists the facts of the given config whose review is due at now,
+// most overdue first.
+func (deck Deck) Due(config string, now time.Time) []Problem {
+	var cards []*Card
+	for _, card := range deck.Cards {
+		if card.Config == config && !card.Due.After(now) {
+			cards = append(cards, card)
+		}
+	}
+	sort.Slice(cards, func(i int, j int) bool {
+		if !cards[i].Due.Equal(cards[j].Due) {
+			return cards[i].Due.Before(cards[j].Due)
+		}
+		return cards[i].Problem.String() < cards[j].Problem.String()
+	})
+	var problems []Problem
+	for _, card := range cards {
+		problems = append(problems, card.Problem)
+	}
+	return problems
+}
+
+// gradeSolveTime maps a solve time onto the SM-2 0-5 quality scale. Anything
+// slower than 8 seconds counts as a failed recall.
+func gradeSolveTime(ms int64) int {
+	switch {
+	case ms < 0:
+		return 0
+	case ms < 2000:
+		return 5
+	case ms < 4000:
+		return 4
+	case ms < 8000:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// Review applies one SM-2 review of quality 0-5 to the fact's card, creating
+// the card if this is the first time the fact was seen.
+func (deck Deck) Review(problem Problem, config string, quality int, now time.Time) *Card {
+	key := cardKey(config, problem)
+	card, ok := deck.Cards[key]
+	if !ok {
+		card = &Card{Problem: problem, Config: config, Ease: 2.5}
+		deck.Cards[key] = card
+	}
+
+	if quality < 3 {
+		card.Repetitions = 0
+		card.Interval = 1
+	} else {
+		switch card.Repetitions {
+		case 0:
+			card.Interval = 1
+		case 1:
+			card.Interval = 6
+		default:
+			card.Interval = int(math.Round(float64(card.Interval) * card.Ease))
+		}
+		card.Repetitions++
+	}
+	missed := float64(5 - quality)
+	card.Ease = max(card.Ease+0.1-missed*(0.08+missed*0.02), 1.3)
+	card.Due = now.AddDate(0, 0, card.Interval)
+	return card
+}
+
+// resultRecorder is implemented by problem sources that want to hear how
+// long each of their problems took to solve, or -1 for the problem left
+// unanswered when the game ends. An error from Record doesn't stop the game.
+type resultRecorder interface {
+	Record(problem Problem, ms int64) error
+}
+
+// practiceSource serves the config's due facts first, then falls back to
+// newly generated problems. Every solve is graded and saved straight away so
+// an interrupted session keeps its progress.
+type practiceSource struct {
+	config Config
+	dealer *dealer
+	deck   Deck
+	path   string
+	due    []Problem
+}
+
+func newPracticeSource(config Config, scoresPath string, logs []Log) (*practiceSource, error) {
+	config = balanceOperations(config, logs)
+	path := srsPath(scoresPath)
+	deck, err := LoadDeck(path)
+	if err != nil {
+		return nil, err
+	}
+	return &practiceSource{config: config, dealer: newDealer(config, newRand(config.Seed)), deck: deck, path: path, due: deck.Due(config.Name, time.Now())}, nil
+}
+
+func (source *practiceSource) Weights() map[string]int {
+	return source.dealer.Weights()
+}
+
+func (source *practiceSource) Next() Problem {
+	if len(source.due) > 0 {
+		problem := source.due[0]
+		source.due = source.due[1:]
+		source.dealer.remember(problem)
+		return problem
+	}
+	return source.dealer.Next()
+}
+
+func (source *practiceSource) Record(problem Problem, ms int64) error {
+	source.deck.Review(problem, source.config.Name, gradeSolveTime(ms), time.Now())
+	err := source.deck.Save(source.path)
+	if err != nil {
+		return fmt.Errorf("saving practice review: %w", err)
+	}
+	return nil
+}
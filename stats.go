@@ -2,10 +2,14 @@ package main
 
 import (
 	"math"
+	"slices"
 	"sort"
 )
 
 func median(times []int64) int64 {
+	if len(times) == 0 {
+		return 0
+	}
 	sort.Slice(times, func(i int, j int) bool {
 		return times[i] < times[j]
 	})
@@ -19,6 +23,9 @@ func median(times []int64) int64 {
 }
 
 func iqr(times []int64) int64 {
+	if len(times) < 2 {
+		return 0
+	}
 	sort.Slice(times, func(i int, j int) bool {
 		return times[i] < times[j]
 	})
@@ -34,6 +41,9 @@ func iqr(times []int64) int64 {
 }
 
 func mean(times []int64) int64 {
+	if len(times) == 0 {
+		return 0
+	}
 	var mean int64
 	for _, time := range times {
 		mean += time
@@ -42,6 +52,9 @@ func mean(times []int64) int64 {
 }
 
 func stdev(times []int64) int64 {
+	if len(times) < 2 {
+		return 0
+	}
 	mean := mean(times)
 	var res int64
 	for _, time := range times {
@@ -59,3 +72,80 @@ func MeanAndStdev(times []int64) (int64, int64) {
 func MedianAndIqr(times []int64) (int64, int64) {
 	return median(times), iqr(times)
 }
+
+// SolveTimesByOperation groups the solve times of every solved problem in
+// logs by the problem's Kind.
+func SolveTimesByOperation(logs []Log) map[string][]int64 {
+	res := make(map[string][]int64)
+	for _, log := range logs {
+		for i, problem := range log.Problems {
+			if i >= len(log.Times) || log.Times[i] == -1 {
+				continue
+			}
+			res[problem.Kind()] = append(res[problem.Kind()], log.Times[i])
+		}
+	}
+	return res
+}
+
+// sortedOperations lists the operations present in byOperation, known
+// operations first in their usual order and anything else alphabetically.
+func sortedOperations(byOperation map[string][]int64) []string {
+	known := operationNames()
+	var ops []string
+	for _, op := range known {
+		if _, ok := byOperation[op]; ok {
+			ops = append(ops, op)
+		}
+	}
+	var rest []string
+	for op := range byOperation {
+		if !slices.Contains(known, op) {
+			rest = append(rest, op)
+		}
+	}
+	sort.Strings(rest)
+	return append(ops, rest...)
+}
+
+// InputSummary describes how the player typed their way to one answer.
+type InputSummary struct {
+	FirstKey     int64
+	Backspaces   int
+	WrongAnswers int
+	//CorrectionTime is how long it took to solve after the first backspace
+	//or wrong full-length answer, or 0 if there was no mistake
+	CorrectionTime int64
+}
+
+// SummarizeKeystrokes works out first-keystroke latency, backspaces and wrong
+// full-length answers from the keystrokes typed towards the correct answer.
+func SummarizeKeystrokes(correct string, keystrokes []Keystroke) InputSummary {
+	var summary InputSummary
+	if len(keystrokes) == 0 {
+		return summary
+	}
+
+	summary.FirstKey = keystrokes[0].At
+	mistakeAt := int64(-1)
+	previous := ""
+	for _, keystroke := range keystrokes {
+		mistake := false
+		if len(keystroke.Answer) < len(previous) {
+			summary.Backspaces++
+			mistake = true
+		} else if len(keystroke.Answer) == len(correct) && keystroke.Answer != correct {
+			summary.WrongAnswers++
+			mistake = true
+		}
+		if mistake && mistakeAt == -1 {
+			mistakeAt = keystroke.At
+		}
+		previous = keystroke.Answer
+	}
+	last := keystrokes[len(keystrokes)-1]
+	if mistakeAt != -1 && last.Answer == correct {
+		summary.CorrectionTime = last.At - mistakeAt
+	}
+	return summary
+}
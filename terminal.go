@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// terminalInput reads key presses from a raw, non-blocking terminal. Polling
+// rather than blocking on Read lets Close stop the reader promptly.
+type terminalInput struct {
+	file *os.File
+	keys chan KeyEvent
+	done chan struct{}
+}
+
+func newTerminalInput(file *os.File) *terminalInput {
+	input := &terminalInput{file: file, keys: make(chan KeyEvent), done: make(chan struct{})}
+	go input.read()
+	return input
+}
+
+func (input *terminalInput) Keys() <-chan KeyEvent {
+	return input.keys
+}
+
+func (input *terminalInput) Close() {
+	close(input.done)
+}
+
+func (input *terminalInput) read() {
+	defer close(input.keys)
+	buf := make([]byte, 1)
+	for {
+		select {
+		case <-input.done:
+			return
+		default:
+		}
+		n, err := input.file.Read(buf)
+		if err == nil && n > 0 {
+			key := rune(buf[0])
+			if key == '\b' {
+				key = KeyBackspace
+			}
+			select {
+			case input.keys <- KeyEvent{key, time.Now()}:
+			case <-input.done:
+				return
+			}
+			continue
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
+// terminalRenderer draws the game as scrolling problem lines under a status
+// line pinned to the top row. Problems scroll in a region that excludes the
+// top row, so the status can be redrawn without touching the answer line.
+type terminalRenderer struct {
+	config       Config
+	firstProblem bool
+	//statusLine is false when the terminal size is unknown, in which case
+	//there is nowhere safe to pin the status
+	statusLine bool
+}
+
+func (renderer *terminalRenderer) Start(config Config) {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	renderer.statusLine = err == nil && height > 2
+	if renderer.statusLine {
+		//clear the screen and keep the top row out of the scrolling region
+		fmt.Printf("\033[2J\033[2;%dr\033[2;1H", height)
+	}
+	fmt.Printf("duration will be %d\r\n", config.Duration)
+	fmt.Printf("seed: %d\r\n", config.Seed)
+	renderer.config = config
+	renderer.firstProblem = true
+}
+
+// prompt is the problem followed by a hint at the form of its answer.
+func (renderer *terminalRenderer) prompt(problem Problem) string {
+	hint := renderer.config.answerHint(problem)
+	if len(hint) == 0 {
+		return problem.String()
+	}
+	return problem.String() + " " + hint
+}
+
+func (renderer *terminalRenderer) ShowStatus(status Status) {
+	if !renderer.statusLine {
+		return
+	}
+	//save the cursor, draw on the top row and put the cursor back
+	fmt.Printf("\0337\033[1;1H\033[2K%s\0338", formatStatus(status))
+}
+
+func formatStatus(status Status) string {
+	seconds := int((status.Remaining + time.Second - 1) / time.Second)
+	line := fmt.Sprintf("Time: %3ds  Score: %d", seconds, status.Score)
+	if status.BestScore >= 0 {
+		line += fmt.Sprintf("  PB pace: %d (%+d)", status.BestScore, status.Score-status.BestScore)
+	}
+	return line
+}
+
+func (renderer *terminalRenderer) ShowProblem(problem Problem) {
+	if renderer.firstProblem {
+		fmt.Printf("%s: ", renderer.prompt(problem))
+		renderer.firstProblem = false
+	} else {
+		fmt.Printf("\r\n%s: ", renderer.prompt(problem))
+	}
+}
+
+func (renderer *terminalRenderer) ShowAnswer(problem Problem, answer string) {
+	fmt.Printf("\r\033[K")
+	fmt.Printf("%s: %s", renderer.prompt(problem), answer)
+}
+
+func (renderer *terminalRenderer) Finish(score int) {
+	if renderer.statusLine {
+		//resetting the scrolling region homes the cursor, so keep it in place
+		fmt.Printf("\0337\033[r\0338")
+	}
+	fmt.Printf("\r\nScore: %d\r\n", score)
+}
+
+// playGame runs a game on the terminal and appends its log to scoresPath,
+// racing the personal best in logs, the history read from there.
+// SIGINT and SIGTERM end the game early like a quit; either way the log is
+// saved once and the terminal is restored before returning.
+func playGame(config Config, source ProblemSource, scoresPath string, logs []Log) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fd := int(os.Stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, oldState)
+
+	err = syscall.SetNonblock(fd, true)
+	if err != nil {
+		return err
+	}
+	defer syscall.SetNonblock(fd, false)
+
+	input := newTerminalInput(os.Stdin)
+	defer input.Close()
+
+	game := Game{Config: config, Source: source, Input: input, Renderer: &terminalRenderer{}, Clock: systemClock{}}
+	if best, ok := personalBest(logs, config); ok {
+		game.Best = &best
+	}
+	log, runErr := game.Run(ctx)
+	//the game itself was played, so it is logged even if something went
+	//wrong along the way
+	err = appendLog(scoresPath, log)
+	return errors.Join(err, runErr)
+}
@@ -2,106 +2,289 @@ package main
 
 import (
 	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"math"
 	"os"
-	"slices"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	"math/rand/v2"
-
-	"github.com/Knetic/govaluate"
-	"golang.org/x/term"
-)
-
-type Mode int
-
-const (
-	GameMode Mode = iota
-	StatsMode
-	ConfigMode
 )
 
 type Problem struct {
 	FirstNum  int
 	Operation string
 	SecondNum int
+	//Rest continues a chained expression past SecondNum, as in 12 + 7 * 3 - 5
+	Rest []Link
+	//Sequential chains are worked strictly left to right instead of doing
+	//multiplication and division first
+	Sequential bool
+}
+
+// Link is one further step of a chained expression.
+type Link struct {
+	Operation string
+	Num       int
+}
+
+// IsChain reports whether the problem has more than two operands.
+func (problem Problem) IsChain() bool {
+	return len(problem.Rest) > 0
+}
+
+// Kind is what the problem is grouped by in stats: its operation, or
+// OpChain for chained expressions.
+func (problem Problem) Kind() string {
+	if problem.IsChain() {
+		return OpChain
+	}
+	return problem.Operation
 }
 
+// links lists every step of the problem, the first having no operation.
+func (problem Problem) links() []Link {
+	links := []Link{{"", problem.FirstNum}, {problem.Operation, problem.SecondNum}}
+	return append(links, problem.Rest...)
+}
+
+// String writes problem the way its operation formats it. Operations the
+// registry doesn't know, say from logs of other tools, read "a op b".
 func (problem Problem) String() string {
-	return fmt.Sprintf("%d %s %d", problem.FirstNum, problem.Operation, problem.SecondNum)
+	if op := lookupOperation(problem.Kind()); op != nil {
+		return op.Format(problem)
+	}
+	return formatBinary(problem)
 }
 
-func ParseProblem(problemString string) Problem {
+// ParseProblem reads back a problem written by String, trying each
+// operation's form in turn.
+func ParseProblem(problemString string) (Problem, error) {
+	for _, op := range operations {
+		if problem, ok := op.Parse(problemString); ok {
+			return problem, nil
+		}
+	}
 	parts := strings.Split(problemString, " ")
-	firstNum, err := strconv.Atoi(parts[0])
-	if err != nil {
-		panic(err)
+	if len(parts) == 3 {
+		if problem, ok := parseBinary(problemString, parts[1]); ok {
+			return problem, nil
+		}
 	}
-	secondNum, err := strconv.Atoi(parts[2])
+	return Problem{}, fmt.Errorf("malformed problem %q", problemString)
+}
+
+func (problem Problem) MarshalText() ([]byte, error) {
+	return []byte(problem.String()), nil
+}
+
+func (problem *Problem) UnmarshalText(text []byte) error {
+	parsed, err := ParseProblem(string(text))
 	if err != nil {
-		panic(err)
+		return err
 	}
-	return Problem{FirstNum: firstNum, Operation: parts[1], SecondNum: secondNum}
+	*problem = parsed
+	return nil
 }
 
+// LogVersion is the version tag written into every score log line. Lines
+// without a tag are treated as the legacy positional format.
+const LogVersion = 2
+
 type Log struct {
-	Problems   []Problem
-	Times      []int64
-	LogTime    time.Time
-	GameLength int
+	Version           int       `json:"version"`
+	LogTime           time.Time `json:"time"`
+	GameLength        int       `json:"length"`
+	ConfigName        string    `json:"config,omitempty"`
+	ConfigFingerprint string    `json:"fingerprint,omitempty"`
+	Seed              uint64    `json:"seed,omitempty"`
+	Problems          []Problem `json:"problems"`
+	Times             []int64   `json:"times"`
+	//Keystrokes holds, for each problem, every answer the player had typed
+	//as it changed, so typos and hesitation can be told apart later
+	Keystrokes [][]Keystroke `json:"keystrokes,omitempty"`
+	//Answers holds the answer to each problem as it had to be typed, which
+	//depends on the division answer mode
+	Answers []string `json:"answers,omitempty"`
+	//Weights holds the weights operations were drawn with when they were
+	//balanced from history, so the game can be replayed from its seed by a
+	//config with these weights
+	Weights map[string]int `json:"weights,omitempty"`
+}
+
+// ExpectedAnswer is the answer the player had to type for problem i. Logs
+// from before answers were recorded only had whole number answers.
+func (log Log) ExpectedAnswer(i int) (string, bool) {
+	if i < len(log.Answers) {
+		return log.Answers[i], true
+	}
+	if i >= len(log.Problems) {
+		return "", false
+	}
+	ans, err := log.Problems[i].Answer()
+	if err != nil {
+		return "", false
+	}
+	return strconv.Itoa(ans), true
+}
+
+// Keystroke is the player's typed answer right after one key press, At
+// milliseconds after the problem was shown.
+type Keystroke struct {
+	At     int64  `json:"t"`
+	Answer string `json:"a"`
 }
 
 func NewLog(problems []Problem, times []int64, gameLength int) Log {
-	return Log{Problems: problems, Times: times, LogTime: time.Now(), GameLength: gameLength}
+	//the last problem is usually unsolved when the game ends, so mark it with -1
+	for len(times) < len(problems) {
+		times = append(times, -1)
+	}
+	return Log{Version: LogVersion, Problems: problems, Times: times, LogTime: time.Now(), GameLength: gameLength}
 }
 
-func ParseLog(line string) Log {
+func ParseLog(line string) (Log, error) {
 	trimmedLine := strings.Trim(line, "\r\n\t ")
-	parts := strings.Split(trimmedLine, " ")
+	if len(trimmedLine) == 0 {
+		return Log{}, fmt.Errorf("empty log")
+	}
+	if strings.HasPrefix(trimmedLine, "{") {
+		return parseVersionedLog(trimmedLine)
+	}
+	return parseLegacyLog(trimmedLine)
+}
+
+func parseVersionedLog(line string) (Log, error) {
+	var log Log
+	err := json.Unmarshal([]byte(line), &log)
+	if err != nil {
+		return Log{}, err
+	}
+	if log.Version <= 1 || log.Version > LogVersion {
+		return Log{}, fmt.Errorf("unsupported log version %d", log.Version)
+	}
+	return log, nil
+}
+
+// parseLegacyLog reads the original "unix gamelength a op b ms ..." layout.
+func parseLegacyLog(line string) (Log, error) {
+	parts := strings.Split(line, " ")
+	if len(parts) < 2 || (len(parts)-2)%4 != 0 {
+		return Log{}, fmt.Errorf("malformed legacy log with %d fields", len(parts))
+	}
 
 	logTimeUnix, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
-		panic(err)
+		return Log{}, err
 	}
 	logTime := time.Unix(logTimeUnix, 0)
 
 	gameLength, err := strconv.Atoi(parts[1])
 	if err != nil {
-		panic(err)
+		return Log{}, err
 	}
 
 	var problems []Problem
 	var times []int64
 	for i := 2; i < len(parts)-3; i += 4 {
-		problem := ParseProblem(parts[i] + " " + parts[i+1] + " " + parts[i+2])
+		problem, err := ParseProblem(parts[i] + " " + parts[i+1] + " " + parts[i+2])
+		if err != nil {
+			return Log{}, err
+		}
 		problems = append(problems, problem)
 		time, err := strconv.ParseInt(parts[i+3], 10, 64)
 		if err != nil {
-			panic(err)
+			return Log{}, err
 		}
 		times = append(times, time)
 	}
 
-	return Log{Problems: problems, Times: times, LogTime: logTime, GameLength: gameLength}
+	return Log{Version: 1, Problems: problems, Times: times, LogTime: logTime, GameLength: gameLength}, nil
 }
 
 func (log Log) String() string {
+	log.Version = LogVersion
+	res, err := json.Marshal(log)
+	if err != nil {
+		panic(err)
+	}
+	return string(res) + "\r\n"
+}
+
+// CorruptLogError lists the lines of a score log that couldn't be parsed.
+type CorruptLogError struct {
+	Path  string
+	Lines []int
+	Errs  []error
+}
+
+func (err *CorruptLogError) Error() string {
 	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%s: %d corrupt lines", err.Path, len(err.Lines)))
+	for i := range err.Lines {
+		sb.WriteString(fmt.Sprintf("\r\n  line %d: %v", err.Lines[i], err.Errs[i]))
+	}
+	return sb.String()
+}
 
-	sb.WriteString(strconv.FormatInt(time.Now().Unix(), 10) + " ")
-	sb.WriteString(strconv.Itoa(log.GameLength) + " ")
-	for i := 0; i < len(log.Problems)-1; i++ {
-		sb.WriteString(log.Problems[i].String() + " " + strconv.FormatInt(log.Times[i], 10) + " ")
+// readLogs parses every game in a score log. Corrupt lines are skipped and
+// reported through a *CorruptLogError alongside the games that did parse.
+func readLogs(filepath string) ([]Log, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
 	}
-	sb.WriteString(log.Problems[len(log.Problems)-1].String() + " " + "-1" + "\r\n")
+	defer file.Close()
 
-	return sb.String()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var logs []Log
+	corrupt := &CorruptLogError{Path: filepath}
+	lineNum := 0
+	for scanner.Scan() {
+		line := scanner.Text()
+		lineNum++
+		if len(strings.Trim(line, "\r\n\t ")) == 0 {
+			continue
+		}
+		log, err := ParseLog(line)
+		if err != nil {
+			corrupt.Lines = append(corrupt.Lines, lineNum)
+			corrupt.Errs = append(corrupt.Errs, err)
+			continue
+		}
+		logs = append(logs, log)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(corrupt.Lines) > 0 {
+		return logs, corrupt
+	}
+	return logs, nil
+}
+
+// readLogsForReport reads a score log for display, warning about corrupt
+// lines instead of giving up on the whole file. A missing log reads as no
+// games.
+func readLogsForReport(filepath string) ([]Log, error) {
+	logs, err := readLogs(filepath)
+	if os.IsNotExist(err) {
+		fmt.Printf("No scores recorded yet in %s\r\n", filepath)
+		return nil, nil
+	}
+	var corrupt *CorruptLogError
+	if errors.As(err, &corrupt) {
+		fmt.Printf("WARNING: skipping %v\r\n\r\n", err)
+	} else if err != nil {
+		return nil, err
+	}
+	return logs, nil
 }
 
 type AdditionConfig struct {
@@ -144,14 +327,26 @@ type DivisionConfig struct {
 	MinRight           int
 	MaxRight           int
 	ForceCleanDivision bool
+	//AnswerMode is how quotients that don't come out clean are answered, one
+	//of the DivisionAnswer constants. Empty means DivisionInteger.
+	AnswerMode string `json:",omitempty"`
+	//DecimalPlaces is what decimal answers are rounded to
+	DecimalPlaces int `json:",omitempty"`
 }
 
 func (config DivisionConfig) String() string {
-	return fmt.Sprintf("%d-%d\t%d-%d\t%t", config.MinLeft, config.MaxLeft, config.MinRight, config.MaxRight, config.ForceCleanDivision)
+	mode := config.AnswerMode
+	if mode == DivisionDecimal {
+		mode = fmt.Sprintf("%s:%d", mode, config.DecimalPlaces)
+	}
+	return fmt.Sprintf("%d-%d\t%d-%d\t%t\t%s", config.MinLeft, config.MaxLeft, config.MinRight, config.MaxRight, config.ForceCleanDivision, mode)
 }
 
 type Config struct {
-	Name                      string
+	Name string
+	//Extends names the saved config or preset this one starts from; see
+	//loadConfigFile
+	Extends                   string `json:",omitempty"`
 	AdditionConfig            AdditionConfig
 	SubtractionConfig         SubtractionConfig
 	MultiplicationConfig      MultiplicationConfig
@@ -160,293 +355,372 @@ type Config struct {
 	OverrideDivisionConfig    bool
 	Duration                  int
 	LegalOperations           []string
+	Adaptive                  bool
+	Seed                      uint64
+	//Weights sets how often each operation comes up relative to the others;
+	//operations it doesn't list weigh defaultWeight
+	Weights map[string]int `json:",omitempty"`
+	//BalanceOperations replaces Weights with weights worked out from past
+	//solve times, so each operation takes up about the same share of a game
+	BalanceOperations bool `json:",omitempty"`
+	//NoRepeatWindow keeps a fact from coming up again within that many
+	//problems
+	NoRepeatWindow int `json:",omitempty"`
+	//SuppressCommutative counts 3 * 7 and 7 * 3 as the same fact, for the
+	//repeat window and the deck
+	SuppressCommutative bool `json:",omitempty"`
+	//DeckMode deals each operation's facts from a shuffled deck, so every
+	//fact comes up once before any comes up again
+	DeckMode bool `json:",omitempty"`
+	//Settings holds the settings of operations beyond the original four
+	Settings OperationSettings `json:",omitempty"`
 }
 
-func (config *Config) Load(filepath string) {
+func (config *Config) Load(filepath string) error {
 	fmt.Printf("\r\nLoading config %s\r\n", filepath)
-	file, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE, 0644)
+	loaded, err := loadConfigFile(filepath, nil)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	buffer := make([]byte, 100*1024)
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
-		panic(err)
+	*config = loaded
+	return nil
+}
+
+// Save writes the config to a temporary file and renames it into place, so
+// an interrupted save never leaves a half-written config behind.
+func (config Config) Save(filepath string) error {
+	res, err := json.Marshal(config)
+	if err != nil {
+		return err
 	}
-	json.Unmarshal(buffer[:n], config)
+	return writeFileAtomic(filepath, res)
 }
 
-func (config Config) Save(filepath string) {
-	file, err := os.OpenFile(filepath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
 	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(file.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// Fingerprint identifies the problem set a config generates. The name,
+// duration and seed are left out so renamed, re-timed or reseeded copies
+// share a fingerprint.
+func (config Config) Fingerprint() string {
+	config.Name = ""
+	config.Extends = ""
+	config.Duration = 0
+	config.Seed = 0
+	//settings of operations that don't matter to the config are left out,
+	//which keeps fingerprints from before later operations existed unchanged
+	clearUncheckedSettings(&config)
+	config.Weights = config.effectiveWeights()
 	res, err := json.Marshal(config)
 	if err != nil {
 		panic(err)
 	}
-	file.Write(res)
+	sum := sha256.Sum256(res)
+	return hex.EncodeToString(sum[:6])
 }
 
 func (config Config) String() string {
-	return fmt.Sprintf("%s\r\n%s\r\n%s \r\n%s \r\n%s \r\n%t %t %d %s\r\n", config.Name, config.AdditionConfig.String(), config.SubtractionConfig.String(), config.MultiplicationConfig.String(), config.DivisionConfig.String(), config.OverrideSubtractionConfig, config.OverrideDivisionConfig, config.Duration, strings.Join(config.LegalOperations, " "))
+	var sb strings.Builder
+	sb.WriteString(config.Name + "\r\n")
+	for _, op := range operations {
+		sb.WriteString(fmt.Sprintf("%v\r\n", op.Settings(config)))
+	}
+	sb.WriteString(fmt.Sprintf("%t %t %d %s %t %d\r\n", config.OverrideSubtractionConfig, config.OverrideDivisionConfig, config.Duration, strings.Join(config.LegalOperations, " "), config.Adaptive, config.Seed))
+	sb.WriteString(fmt.Sprintf("%v %t %d %t %t\r\n", config.Weights, config.BalanceOperations, config.NoRepeatWindow, config.SuppressCommutative, config.DeckMode))
+	return sb.String()
 }
 
 func GetZetamacConfig() Config {
 	add := AdditionConfig{2, 100, 2, 100}
 	sub := SubtractionConfig{2, 100, 2, 100, true}
 	mult := MultiplicationConfig{2, 12, 2, 100}
-	div := DivisionConfig{2, 1200, 2, 100, true}
-	return Config{"default", add, sub, mult, div, true, true, 120, []string{"+", "-", "/", "*"}}
+	div := DivisionConfig{2, 1200, 2, 100, true, "", 0}
+	return Config{
+		Name:                      "default",
+		AdditionConfig:            add,
+		SubtractionConfig:         sub,
+		MultiplicationConfig:      mult,
+		DivisionConfig:            div,
+		OverrideSubtractionConfig: true,
+		OverrideDivisionConfig:    true,
+		Duration:                  120,
+		LegalOperations:           []string{"+", "-", "/", "*"},
+		Settings: OperationSettings{
+			OpSquare:     SquareConfig{2, 30},
+			OpPower:      PowerConfig{2, 10, 2, 4},
+			OpSquareRoot: RootConfig{2, 30},
+			OpCubeRoot:   RootConfig{2, 10},
+			OpModulo:     ModuloConfig{2, 100, 2, 12},
+			OpPercent:    PercentConfig{5, 100, 2, 400},
+			OpChain:      ChainConfig{3, []string{"+", "-", "*"}, false, 2, 20, 0, 500},
+		},
+	}
 }
 
-var mode Mode
-var currentProblem Problem
-
-const ClearSignal = "clear"
-const QuitSignal = "quit"
-
-func handleClargs(config *Config) {
-	clargs := os.Args
-	if len(clargs) <= 1 {
-		if fileExists("configs/default.txt") {
-			config.Load("configs/default.txt")
-		} else {
-			*config = GetZetamacConfig()
-		}
-		return
-	}
-	if clargs[1] == "-s" {
-		mode = StatsMode
-	} else if clargs[1] == "-c" {
-		mode = ConfigMode
-	} else {
-		//we are in game mode, so load relevant config
-		config.Load("configs/" + clargs[1] + ".txt")
-		mode = GameMode
+func loadDefaultConfig(config *Config, paths Paths) error {
+	if fileExists(paths.Config("default")) {
+		return config.Load(paths.Config("default"))
 	}
+	*config = GetZetamacConfig()
+	return nil
+}
 
-	for i := 1; i < len(os.Args)-1; i++ {
-		if clargs[i] == "-t" {
-			num, err := strconv.Atoi(clargs[i+1])
-			if err != nil {
-				fmt.Printf("Enter an integer number of seconds\r\n")
-			}
-			config.Duration = num
-		}
+// loadNamedConfig loads the saved config called name, or else the preset
+// called name, or the default config when name is empty.
+func loadNamedConfig(paths Paths, name string) (Config, error) {
+	var config Config
+	if len(name) == 0 {
+		err := loadDefaultConfig(&config, paths)
+		return config, err
+	}
+	if preset, ok := lookupPreset(name); ok && !fileExists(paths.Config(name)) {
+		return preset, nil
 	}
+	err := config.Load(paths.Config(name))
+	return config, err
 }
 
-func readInput(buf []byte, channel chan string) {
-	var answerBuf = make([]byte, 10)
-	answerBufFront := 0
-	for {
-		select {
-		case x, ok := <-channel:
-			if ok {
-				if x == ClearSignal {
-					answerBufFront = 0
-				}
-			} else {
-				fmt.Printf("Something went wrong!")
-			}
-		default:
-		}
-		n, err := os.Stdin.Read(buf)
-		if err == nil && n > 0 {
-			//fmt.Printf("Read: %v\r\n", buf[:n])
-			if (buf[0] < 48 || buf[0] > 57) && buf[0] != 0x7f && buf[0] != 'q' {
-				continue
-			}
-			if buf[0] == 127 || buf[0] == 8 {
-				if answerBufFront <= 0 {
-					continue
-				}
-				answerBufFront--
-
-				//fmt.Printf("\b \b")
-			} else if buf[0] == 'q' {
-				channel <- QuitSignal
-				return
-			} else {
-				if answerBufFront >= len(answerBuf) {
-					continue
-				}
-				answerBuf[answerBufFront] = buf[0]
-				answerBufFront++
-			}
-			fmt.Printf("\r\033[K")
-			fmt.Printf("%s: %s", currentProblem, string(answerBuf[0:answerBufFront]))
-
-			//fmt.Printf("%c", buf[0])
-			//fmt.Printf("Current answer: %s\n", answerBuf[0:answerBufFront])
-			channel <- string(answerBuf[0:answerBufFront])
-		}
-		time.Sleep(time.Millisecond * 5)
-	}
+// newRand returns the generator a game draws all of its problems from, so a
+// game can be replayed by reusing its seed.
+func newRand(seed uint64) *rand.Rand {
+	return rand.New(rand.NewPCG(seed, seed))
 }
 
-func randRange(min int, max int) int {
-	return rand.IntN(max-min+1) + min
+func randRange(rng *rand.Rand, min int, max int) int {
+	return rng.IntN(max-min+1) + min
 }
 
-func genAdditionProblem(config AdditionConfig) Problem {
+func genAdditionProblem(rng *rand.Rand, config AdditionConfig) Problem {
 	var problem Problem
 	problem.Operation = "+"
-	problem.FirstNum = randRange(config.MinLeft, config.MaxLeft)
-	problem.SecondNum = randRange(config.MinRight, config.MaxRight)
+	problem.FirstNum = randRange(rng, config.MinLeft, config.MaxLeft)
+	problem.SecondNum = randRange(rng, config.MinRight, config.MaxRight)
 	return problem
 }
 
-func genMultiplicationProblem(config MultiplicationConfig) Problem {
+func genMultiplicationProblem(rng *rand.Rand, config MultiplicationConfig) Problem {
 	var problem Problem
 	problem.Operation = "*"
-	problem.FirstNum = randRange(config.MinLeft, config.MaxLeft)
-	problem.SecondNum = randRange(config.MinRight, config.MaxRight)
+	problem.FirstNum = randRange(rng, config.MinLeft, config.MaxLeft)
+	problem.SecondNum = randRange(rng, config.MinRight, config.MaxRight)
 	return problem
 }
 
-func genSubtractionProblem(config SubtractionConfig) Problem {
-	var problem Problem
-	problem.Operation = "-"
-	for true {
-		problem.FirstNum = randRange(config.MinLeft, config.MaxLeft)
-		problem.SecondNum = randRange(config.MinRight, config.MaxRight)
-		if !config.ForceNonnegativeDifference || problem.FirstNum-problem.SecondNum >= 0 {
-			return problem
+// genSubtractionProblem draws uniformly from the operand pairs the config
+// allows. Pairs with a non-negative difference are sampled directly, by
+// splitting them into left operands past every right operand, right operands
+// no larger than any overlapping left operand, and the triangle where both
+// fall in the overlap.
+func genSubtractionProblem(rng *rand.Rand, config SubtractionConfig) Problem {
+	problem := Problem{Operation: "-"}
+	if !config.ForceNonnegativeDifference {
+		problem.FirstNum = randRange(rng, config.MinLeft, config.MaxLeft)
+		problem.SecondNum = randRange(rng, config.MinRight, config.MaxRight)
+		return problem
+	}
+	past := max(config.MinLeft, config.MaxRight+1)
+	lo, hi := max(config.MinLeft, config.MinRight), min(config.MaxLeft, config.MaxRight)
+	var sizes [3]float64
+	if past <= config.MaxLeft {
+		sizes[0] = float64(config.MaxLeft-past+1) * float64(config.MaxRight-config.MinRight+1)
+	}
+	if lo <= hi {
+		sizes[1] = float64(hi-lo+1) * float64(lo-config.MinRight+1)
+		sizes[2] = float64(hi-lo) * float64(hi-lo+1) / 2
+	}
+	switch pickWeighted(rng, sizes[:]) {
+	case 0:
+		problem.FirstNum = randRange(rng, past, config.MaxLeft)
+		problem.SecondNum = randRange(rng, config.MinRight, config.MaxRight)
+	case 1:
+		problem.FirstNum = randRange(rng, lo, hi)
+		problem.SecondNum = randRange(rng, config.MinRight, lo)
+	case 2:
+		//folding the n by n+1 rectangle in half covers the triangle evenly
+		n := hi - lo
+		left, right := randRange(rng, 1, n), randRange(rng, 1, n+1)
+		if right > left {
+			left, right = n+1-left, n+2-right
 		}
+		problem.FirstNum, problem.SecondNum = lo+left, lo+right
+	default:
+		//validateConfig checks there is a non-negative difference
+		panic("no subtraction operands with a non-negative difference")
 	}
-	//this will never hit
 	return problem
 }
 
-func genDivisionProblem(config DivisionConfig) Problem {
-	var problem Problem
-	problem.Operation = "/"
-	for true {
-		problem.FirstNum = randRange(config.MinLeft, config.MaxLeft)
-		problem.SecondNum = randRange(config.MinRight, config.MaxRight)
-		if !config.ForceCleanDivision || problem.FirstNum%problem.SecondNum == 0 {
-			return problem
+// pickWeighted chooses an index of sizes with probability proportional to
+// its size, or -1 if every size is 0. Sizes are floats since pair counts of
+// wide ranges overflow int.
+func pickWeighted(rng *rand.Rand, sizes []float64) int {
+	total := 0.0
+	for _, size := range sizes {
+		total += size
+	}
+	pick := rng.Float64() * total
+	last := -1
+	for i, size := range sizes {
+		if size == 0 {
+			continue
+		}
+		last = i
+		if pick < size {
+			return i
 		}
+		pick -= size
 	}
-	//this will never hit
-	return problem
+	return last
 }
 
-func genProblem(config Config) Problem {
-	operation := config.LegalOperations[randRange(0, len(config.LegalOperations)-1)]
-
-	if operation == "-" && config.OverrideSubtractionConfig {
-		addProblem := genAdditionProblem(config.AdditionConfig)
-		ans := getProblemAnswer(addProblem)
-		return Problem{ans, "-", addProblem.FirstNum}
-	} else if operation == "/" && config.OverrideDivisionConfig {
-		multProblem := genMultiplicationProblem(config.MultiplicationConfig)
-		ans := getProblemAnswer(multProblem)
-		return Problem{ans, "/", multProblem.FirstNum}
-	} else if operation == "+" {
-		return genAdditionProblem(config.AdditionConfig)
-	} else if operation == "*" {
-		return genMultiplicationProblem(config.MultiplicationConfig)
-	} else if operation == "-" {
-		return genSubtractionProblem(config.SubtractionConfig)
-	} else {
-		return genDivisionProblem(config.DivisionConfig)
+// maxCleanDividend bounds dividends under clean division, which keeps
+// listing the divisors of the range quick.
+const maxCleanDividend = 100_000_000
+
+// divisorRun is a run of divisors that each have the same number of
+// multiples among the dividends.
+type divisorRun struct {
+	First     int
+	Last      int
+	Multiples int
+}
+
+// cleanDivisors groups the divisors in range by how many multiples they have
+// among the dividends. The count only changes about 4*sqrt(MaxLeft) times
+// over the range, so there are few runs even for wide ranges.
+func (config DivisionConfig) cleanDivisors() []divisorRun {
+	var runs []divisorRun
+	below := config.MinLeft - 1
+	for divisor := config.MinRight; divisor <= min(config.MaxRight, config.MaxLeft); {
+		last := min(config.MaxRight, config.MaxLeft/(config.MaxLeft/divisor))
+		if below >= divisor {
+			last = min(last, below/(below/divisor))
+		}
+		if multiples := config.MaxLeft/divisor - below/divisor; multiples > 0 {
+			runs = append(runs, divisorRun{divisor, last, multiples})
+		}
+		divisor = last + 1
 	}
+	return runs
 }
 
-func getProblemAnswer(problem Problem) int {
-	expression, err := govaluate.NewEvaluableExpression(problem.String())
-	if err != nil {
-		fmt.Print("Error parsing expression\r\n")
-		panic(err)
+// longestAnswer is how many characters the longest answer to a division in
+// range takes to type, for positive operands.
+func (config DivisionConfig) longestAnswer() int {
+	length := len(strconv.Itoa(config.MaxLeft / config.MinRight))
+	if config.ForceCleanDivision {
+		return length
 	}
-	evaluated, err := expression.Evaluate(nil)
-	if err != nil {
-		fmt.Print("Error evaluating expression\r\n")
+	switch config.AnswerMode {
+	case DivisionRemainder:
+		return length + 1 + len(strconv.Itoa(min(config.MaxRight-1, config.MaxLeft)))
+	case DivisionDecimal:
+		return length + 1 + config.DecimalPlaces
 	}
-	return int(evaluated.(float64))
+	return length
 }
 
-func saveScores(problems []Problem, times []int64, filepath string, config Config) {
-	var file *os.File
-	var err error
-	file, err = os.OpenFile(filepath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
-	if err != nil {
-		panic(err)
+// cleanDivisions counts the operand pairs that divide cleanly.
+func (config DivisionConfig) cleanDivisions() int {
+	total := 0
+	for _, run := range config.cleanDivisors() {
+		total += (run.Last - run.First + 1) * run.Multiples
 	}
-	defer file.Close()
-
-	file.WriteString(NewLog(problems, times, config.Duration).String())
+	return total
 }
 
-func gameLoop(config Config, inputChannel chan string, oldState *term.State) {
-	fmt.Printf("duration will be %d\r\n", config.Duration)
-	var problems []Problem
-	var times []int64
-	score := 0
-	timer := time.NewTimer(time.Duration(config.Duration) * time.Second)
-	firstProblem := true
-	cleanup := func() {
-		fmt.Printf("\r\nScore: %d\r\n", score)
-		saveScores(problems, times, "scores.txt", config)
-
-		term.Restore(int(os.Stdin.Fd()), oldState)
-		return
+// genDivisionProblem draws uniformly from the operand pairs the config
+// allows. Clean divisions are sampled directly: a divisor weighted by its
+// multiples among the dividends, then one of those multiples.
+func genDivisionProblem(rng *rand.Rand, config DivisionConfig) Problem {
+	problem := Problem{Operation: "/"}
+	if !config.ForceCleanDivision {
+		problem.FirstNum = randRange(rng, config.MinLeft, config.MaxLeft)
+		problem.SecondNum = randRange(rng, config.MinRight, config.MaxRight)
+		return problem
+	}
+	total := config.cleanDivisions()
+	if total == 0 {
+		//validateConfig checks there is a clean division
+		panic("no clean divisions in range")
+	}
+	pick := randRange(rng, 0, total-1)
+	for _, run := range config.cleanDivisors() {
+		size := (run.Last - run.First + 1) * run.Multiples
+		if pick >= size {
+			pick -= size
+			continue
+		}
+		divisor := run.First + pick/run.Multiples
+		quotient := (config.MinLeft-1)/divisor + 1 + pick%run.Multiples
+		problem.FirstNum, problem.SecondNum = divisor*quotient, divisor
+		break
 	}
-	defer cleanup()
+	return problem
+}
 
-	go func() {
-		<-timer.C
-		cleanup()
-		os.Exit(0)
-	}()
+func genProblem(rng *rand.Rand, config Config) Problem {
+	return lookupOperation(config.pickOperation(rng)).Generate(rng, config)
+}
 
-	for {
-		problem := genProblem(config)
-		currentProblem = problem
-		problemAns := getProblemAnswer(problem)
-		problems = append(problems, problem)
-		if firstProblem {
-			fmt.Printf("%s: ", problem)
-			firstProblem = false
-		} else {
-			fmt.Printf("\r\n%s: ", problem)
-		}
-		startTime := time.Now()
-
-		for {
-			userAns := <-inputChannel
-			if userAns == strconv.Itoa(problemAns) {
-				times = append(times, time.Now().Sub(startTime).Milliseconds())
-				//fmt.Printf("\r\nYou got the right answer\r\n")
-				score++
-				inputChannel <- ClearSignal
-				break
-			}
-			if userAns == QuitSignal {
-				return
-			}
-		}
+// appendLog adds a finished game to the end of the score log.
+func appendLog(scoresPath string, log Log) error {
+	err := os.MkdirAll(filepath.Dir(scoresPath), 0755)
+	if err != nil {
+		return err
 	}
+	file, err := os.OpenFile(scoresPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.WriteString(log.String())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-func printStats(filepath string) {
-	file, err := os.Open(filepath)
+// matchesConfig reports whether a log was played with the config named by
+// filter, given either as a config name or a fingerprint.
+func (log Log) matchesConfig(filter string) bool {
+	return filter == "" || log.ConfigName == filter || log.ConfigFingerprint == filter
+}
+
+func printStats(filepath string, configFilter string) error {
+	allLogs, err := readLogsForReport(filepath)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
 	var logs []Log
-	for scanner.Scan() {
-		line := scanner.Text()
-		if len(strings.Trim(line, "\r\n\t ")) == 0 {
-			continue
+	for _, log := range allLogs {
+		if log.matchesConfig(configFilter) {
+			logs = append(logs, log)
 		}
-		logs = append(logs, ParseLog(line))
 	}
 	var times []int64
 	for _, log := range logs {
@@ -457,10 +731,65 @@ func printStats(filepath string) {
 			times = append(times, time)
 		}
 	}
+	if len(configFilter) > 0 {
+		fmt.Printf("Config: %s\r\n", configFilter)
+	}
+	fmt.Printf("Games: %d\r\n", len(logs))
+	if len(times) == 0 {
+		fmt.Printf("No solved problems recorded\r\n")
+		return nil
+	}
 	median, iqr := MedianAndIqr(times)
 	mean, stdev := MeanAndStdev(times)
 	fmt.Printf("Median: %d \r\nIQR: %d\r\n", median, iqr)
 	fmt.Printf("Mean: %d \r\nSTDev: %d\r\n", mean, stdev)
+
+	byOperation := SolveTimesByOperation(logs)
+	fmt.Printf("\r\n%-4s %7s %7s %7s %7s %7s\r\n", "Op", "Count", "Median", "IQR", "Mean", "STDev")
+	for _, op := range sortedOperations(byOperation) {
+		opTimes := byOperation[op]
+		median, iqr := MedianAndIqr(opTimes)
+		mean, stdev := MeanAndStdev(opTimes)
+		fmt.Printf("%-4s %7d %7d %7d %7d %7d\r\n", op, len(opTimes), median, iqr, mean, stdev)
+	}
+
+	printInputStats(logs, median)
+	return nil
+}
+
+func printInputStats(logs []Log, medianSolveTime int64) {
+	var firstKeys, correctionTimes []int64
+	backspaces, wrongAnswers := 0, 0
+	for _, log := range logs {
+		for i := range log.Keystrokes {
+			if i >= len(log.Problems) || i >= len(log.Times) || log.Times[i] == -1 || len(log.Keystrokes[i]) == 0 {
+				continue
+			}
+			correct, ok := log.ExpectedAnswer(i)
+			if !ok {
+				continue
+			}
+			summary := SummarizeKeystrokes(correct, log.Keystrokes[i])
+			firstKeys = append(firstKeys, summary.FirstKey)
+			backspaces += summary.Backspaces
+			wrongAnswers += summary.WrongAnswers
+			if summary.Backspaces > 0 || summary.WrongAnswers > 0 {
+				correctionTimes = append(correctionTimes, summary.CorrectionTime)
+			}
+		}
+	}
+	if len(firstKeys) == 0 {
+		return
+	}
+	solved := len(firstKeys)
+	firstKey := median(firstKeys)
+	fmt.Printf("\r\nInput (%d solves with keystrokes)\r\n", solved)
+	fmt.Printf("First keystroke: %dms median", firstKey)
+	if medianSolveTime > 0 {
+		fmt.Printf(" (%d%% of median solve time)", firstKey*100/medianSolveTime)
+	}
+	fmt.Printf("\r\nCorrected solves: %d (%d%%), %dms median lost correcting\r\n", len(correctionTimes), len(correctionTimes)*100/solved, median(correctionTimes))
+	fmt.Printf("Backspaces: %d, wrong full-length answers: %d\r\n", backspaces, wrongAnswers)
 }
 
 func fileExists(path string) bool {
@@ -607,12 +936,33 @@ func setupDivisionConfig(config *DivisionConfig, reader *bufio.Reader) {
 
 	fmt.Printf("\r\nForce numbers to be evenly divisible?%s", bracketCurrentOption(config.ForceCleanDivision))
 	setByInput(getCleanInput(reader), &config.ForceCleanDivision)
+
+	mode := config.AnswerMode
+	if len(mode) == 0 {
+		mode = DivisionInteger
+	}
+	fmt.Printf("\r\nAnswer uneven quotients as %s, %s or %s [%s]: ", DivisionInteger, DivisionRemainder, DivisionDecimal, mode)
+	line = getCleanInput(reader)
+	if len(line) > 0 {
+		config.AnswerMode = line
+	}
+	if config.AnswerMode == DivisionDecimal {
+		if config.DecimalPlaces == 0 {
+			config.DecimalPlaces = 2
+		}
+		fmt.Printf("\r\nDecimal places to round to [%d]: ", config.DecimalPlaces)
+		line = getCleanInput(reader)
+		num, err = strconv.Atoi(line)
+		if err == nil && len(line) > 0 {
+			config.DecimalPlaces = num
+		}
+	}
 }
-func setupConfig() {
+func setupConfig(paths Paths) error {
 	var config Config
-	err := os.MkdirAll("configs", 0755)
+	err := os.MkdirAll(paths.ConfigDir, 0755)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Printf("Enter config name, or leave empty to override the default: ")
@@ -620,19 +970,31 @@ func setupConfig() {
 	if len(configName) == 0 {
 		fmt.Printf("\r\nModifying default config.")
 		config.Name = "default"
-		if fileExists("configs/default.txt") {
-			config.Load("configs/default.txt")
-		} else {
-			config = GetZetamacConfig()
+		err = loadDefaultConfig(&config, paths)
+		if err != nil {
+			return err
 		}
-	} else if fileExists("configs/" + configName + ".txt") {
+	} else if fileExists(paths.Config(configName)) {
 		fmt.Printf("\r\nModifying existing config.")
-		config.Load("configs/" + configName + ".txt")
+		err = config.Load(paths.Config(configName))
+		if err != nil {
+			return err
+		}
+		if len(config.Extends) > 0 {
+			fmt.Printf("\r\nThis config extends %s, it will be saved as a full copy with your changes.", config.Extends)
+			config.Extends = ""
+		}
 	} else {
 		fmt.Printf("\r\nInitializing new config.")
-		config = GetZetamacConfig()
+		fmt.Printf("\r\nStart from which preset (%s)? [zetamac]: ", strings.Join(presetNames(), ", "))
+		preset, ok := lookupPreset(getCleanInput(reader))
+		if !ok {
+			preset = GetZetamacConfig()
+		}
+		config = preset
 		config.Name = configName
 	}
+	fillOperationDefaults(&config)
 
 	fmt.Printf("\r\nModify game meta-settings? y/[n]: ")
 	input := getCleanInput(reader)
@@ -653,49 +1015,51 @@ func setupConfig() {
 			config.Duration = num
 		}
 		var ops []string
-		fmt.Printf("\r\nEnable addition?%s", bracketCurrentOption(slices.Contains(config.LegalOperations, "+")))
-		input = getCleanInput(reader)
-		if input == "y" {
-			ops = append(ops, "+")
+		for _, op := range operations {
+			fmt.Printf("\r\nEnable %s?%s", op.Describe(), bracketCurrentOption(config.enables(op.Name())))
+			input = getCleanInput(reader)
+			if input == "y" {
+				ops = append(ops, op.Name())
+			}
 		}
-		fmt.Printf("\r\nEnable subtraction?%s", bracketCurrentOption(slices.Contains(config.LegalOperations, "-")))
-		input = getCleanInput(reader)
-		if input == "y" {
-			ops = append(ops, "-")
+		config.LegalOperations = ops
+		fmt.Printf("\r\nBalance operations so each takes up about the same time, based on past games?%s", bracketCurrentOption(config.BalanceOperations))
+		setByInput(getCleanInput(reader), &config.BalanceOperations)
+		if !config.BalanceOperations {
+			weights := make(map[string]int)
+			for _, op := range ops {
+				weight := config.weight(op)
+				fmt.Printf("\r\nHow often should %s come up, relative to the others? [%d]: ", lookupOperation(op).Describe(), weight)
+				setIntByInput(getCleanInput(reader), &weight)
+				if weight != defaultWeight {
+					weights[op] = weight
+				}
+			}
+			config.Weights = weights
 		}
-		fmt.Printf("\r\nEnable multiplication?%s", bracketCurrentOption(slices.Contains(config.LegalOperations, "*")))
-		input = getCleanInput(reader)
-		if input == "y" {
-			ops = append(ops, "*")
+		fmt.Printf("\r\nFavor the facts you are slowest on?%s", bracketCurrentOption(config.Adaptive))
+		setByInput(getCleanInput(reader), &config.Adaptive)
+		fmt.Printf("\r\nHow many problems before a fact can come up again? [%d]: ", config.NoRepeatWindow)
+		setIntByInput(getCleanInput(reader), &config.NoRepeatWindow)
+		fmt.Printf("\r\nCount problems like 3 * 7 and 7 * 3 as the same fact?%s", bracketCurrentOption(config.SuppressCommutative))
+		setByInput(getCleanInput(reader), &config.SuppressCommutative)
+		fmt.Printf("\r\nDeal every fact once before repeating any?%s", bracketCurrentOption(config.DeckMode))
+		setByInput(getCleanInput(reader), &config.DeckMode)
+	}
+	for _, op := range operations {
+		if !config.checksOperation(op) {
+			continue
 		}
-		fmt.Printf("\r\nEnable division?%s", bracketCurrentOption(slices.Contains(config.LegalOperations, "/")))
-		input = getCleanInput(reader)
-		if input == "y" {
-			ops = append(ops, "/")
+		fmt.Printf("\r\nModify %s settings? y/[n]: ", op.Describe())
+		if getCleanInput(reader) == "y" {
+			op.Setup(&config, reader)
 		}
-		config.LegalOperations = ops
-	}
-	fmt.Printf("\r\nModify addition settings? y/[n]: ")
-	if getCleanInput(reader) == "y" {
-		setupAdditionConfig(&config.AdditionConfig, reader)
-	}
-	fmt.Printf("\r\nModify subtraction settings? y/[n]: ")
-	if getCleanInput(reader) == "y" {
-		setupSubtractionConfig(&config.SubtractionConfig, reader)
-	}
-	fmt.Printf("\r\nModify multiplication settings? y/[n]: ")
-	if getCleanInput(reader) == "y" {
-		setupMultiplicationConfig(&config.MultiplicationConfig, reader)
-	}
-	fmt.Printf("\r\nModify division settings? y/[n]: ")
-	if getCleanInput(reader) == "y" {
-		setupDivisionConfig(&config.DivisionConfig, reader)
 	}
 
-	config.Save("configs/" + config.Name + ".txt")
+	return config.Save(paths.Config(config.Name))
 }
 
-func validateConfig(config *Config) {
+func validateConfig(config *Config) error {
 	fmt.Printf("%s", config.String())
 	valid := true
 
@@ -706,108 +1070,57 @@ func validateConfig(config *Config) {
 		valid = false
 	}
 
-	//addition rules
-	//1) no non-positive operands
-	//2) operands less than maxint/2
-	//3) maxes >= mins
-	if config.AdditionConfig.MinLeft < 0 || config.AdditionConfig.MinRight < 0 {
-		fmt.Printf("CONFIG ERROR: NON-POSITIVE ADDITION OPERANDS\r\n")
+	//operation rules
+	//1) at least one operation
+	//2) only known operations
+	//3) sensible weights
+	//4) each operation's own rules, for the operations that matter
+	//5) generation policies that can be met, once the operations are valid
+	if len(config.LegalOperations) == 0 {
+		fmt.Printf("CONFIG ERROR: NO OPERATIONS ENABLED\r\n")
 		valid = false
 	}
-	if config.AdditionConfig.MaxLeft >= math.MaxInt/2 || config.AdditionConfig.MaxRight >= math.MaxInt/2 {
-		fmt.Printf("CONFIG ERROR: ADDITION OPERANDS GREATER THAN HALF OF MAX INTEGER VALUE\r\n")
-		valid = false
-	}
-	if config.AdditionConfig.MaxLeft < config.AdditionConfig.MinLeft || config.AdditionConfig.MaxRight < config.AdditionConfig.MinRight {
-		fmt.Printf("CONFIG ERROR: NO POSSIBLE ADDITION OPERANDS\r\n")
-		valid = false
-	}
-
-	//subtraction rules
-	//1) no non-positive operands
-	//2) if the option is set, leftmax > rightmin (so we can always generate difference of at least 0)
-	//3) maxes >= mins
-	if config.SubtractionConfig.MinLeft <= 0 || config.SubtractionConfig.MinRight <= 0 {
-		fmt.Printf("CONFIG ERROR: NON-POSITIVE SUBTRACTION OPERANDS\r\n")
-		valid = false
-	}
-	if config.SubtractionConfig.ForceNonnegativeDifference && config.SubtractionConfig.MaxLeft < config.SubtractionConfig.MinRight {
-		fmt.Printf("CONFIG ERROR: NO POSSIBLE NON-NEGATIVE DIFFERENCES\r\n")
-		valid = false
-	}
-	if config.SubtractionConfig.MaxLeft < config.SubtractionConfig.MinLeft || config.SubtractionConfig.MaxRight < config.SubtractionConfig.MinRight {
-		fmt.Printf("CONFIG ERROR: NO POSSIBLE SUBTRACTION OPERANDS\r\n")
-		valid = false
-	}
-
-	//multiplication rules
-	//1) no non-positive operands
-	//2) operands less than sqrt(maxint)
-	//3) maxes >= mins
-	if config.MultiplicationConfig.MinLeft <= 0 || config.MultiplicationConfig.MinRight <= 0 {
-		fmt.Printf("CONFIG ERROR: NON-POSITIVE MULTIPLICATION OPERANDS\r\n")
-		valid = false
-	}
-	if config.MultiplicationConfig.MaxLeft >= int(math.Sqrt(math.MaxInt)) || config.MultiplicationConfig.MaxRight >= int(math.Sqrt(math.MaxInt/2)) {
-		fmt.Printf("CONFIG ERROR: MULTIPLICATION OPERANDS GREATER THAN SQUARE ROOT OF MAX INTEGER VALUE\r\n")
-		valid = false
-	}
-	if config.MultiplicationConfig.MaxLeft < config.MultiplicationConfig.MinLeft || config.MultiplicationConfig.MaxRight < config.MultiplicationConfig.MinRight {
-		fmt.Printf("CONFIG ERROR: NO POSSIBLE MULTIPLICATION OPERANDS\r\n")
-		valid = false
+	for _, op := range config.LegalOperations {
+		if lookupOperation(op) == nil {
+			fmt.Printf("CONFIG ERROR: UNKNOWN OPERATION %q\r\n", op)
+			valid = false
+		}
 	}
-
-	//divison rules
-	//1) no non-positive operands
-	//2) leftmax >= rightmin (so we can always generate quotient of at least 1)
-	//3) maxes >= mins
-	if config.DivisionConfig.MinLeft <= 0 || config.DivisionConfig.MinRight <= 0 {
-		fmt.Printf("CONFIG ERROR: NON-POSITIVE DIVISION OPERANDS\r\n")
+	for _, msg := range config.validateWeights() {
+		fmt.Printf("CONFIG ERROR: %s\r\n", msg)
 		valid = false
 	}
-	if config.DivisionConfig.MaxLeft < config.DivisionConfig.MinRight {
-		fmt.Printf("CONFIG ERROR: NO POSSIBLE NON-ZERO QUOTIENTS\r\n")
-		valid = false
+	for _, op := range operations {
+		if !config.checksOperation(op) {
+			continue
+		}
+		for _, msg := range op.Validate(*config) {
+			fmt.Printf("CONFIG ERROR: %s\r\n", msg)
+			valid = false
+		}
 	}
-	if config.DivisionConfig.MaxLeft < config.DivisionConfig.MinLeft || config.DivisionConfig.MaxRight < config.DivisionConfig.MinRight {
-		fmt.Printf("CONFIG ERROR: NO POSSIBLE DIVISION OPERANDS\r\n")
-		valid = false
+	if valid {
+		for _, msg := range config.validatePolicies() {
+			fmt.Printf("CONFIG ERROR: %s\r\n", msg)
+			valid = false
+		}
 	}
 	if !valid {
-		os.Exit(1)
+		return errors.New("invalid config")
 	}
+	return nil
 }
 
-func main() {
-	config := GetZetamacConfig()
-	handleClargs(&config)
-
-	switch mode {
-	case StatsMode:
-		printStats("scores.txt")
-		return
-	case ConfigMode: //TODO: implement config mode
-		setupConfig()
-		return
-	case GameMode:
-		validateConfig(&config)
-		oldState, err := term.MakeRaw(int(os.Stdin.Fd()))
-		if err != nil {
-			panic(err)
-		}
-
-		fd := int(os.Stdin.Fd())
-		var buf = make([]byte, 1)
-
-		err = syscall.SetNonblock(fd, true)
-		if err != nil {
-			panic(err)
-		}
-
-		inputChannel := make(chan string)
-		go readInput(buf, inputChannel)
-
-		gameLoop(config, inputChannel, oldState)
+// seedConfig picks a random seed for configs that don't fix one, so every
+// game records the seed it can be replayed with.
+func seedConfig(config *Config) {
+	for config.Seed == 0 {
+		config.Seed = rand.Uint64()
 	}
+}
 
+func main() {
+	//older versions kept everything relative to the working directory
+	cwd, _ := os.Getwd()
+	os.Exit(run(os.Args[1:], cwd))
 }
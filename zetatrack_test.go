@@ -1,24 +1,34 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"math/big"
 	"os"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestParseProblem(t *testing.T) {
-	wantProblem := Problem{10, "*", 20}
-	gotProblem := ParseProblem(wantProblem.String())
-	if wantProblem != gotProblem {
+	wantProblem := Problem{FirstNum: 10, Operation: "*", SecondNum: 20}
+	gotProblem, err := ParseProblem(wantProblem.String())
+	if err != nil || !reflect.DeepEqual(wantProblem, gotProblem) {
 		t.Errorf("Couldn't parse problem %s", wantProblem.String())
 	}
 }
 
 func TestParseProblemLargeOperands(t *testing.T) {
-	wantProblem := Problem{math.MaxInt/2 - 1, "*", math.MaxInt/2 - 2}
-	gotProblem := ParseProblem(wantProblem.String())
-	if wantProblem != gotProblem {
+	wantProblem := Problem{FirstNum: math.MaxInt/2 - 1, Operation: "*", SecondNum: math.MaxInt/2 - 2}
+	gotProblem, err := ParseProblem(wantProblem.String())
+	if err != nil || !reflect.DeepEqual(wantProblem, gotProblem) {
 		t.Errorf("Coudldn't parse problem %s", wantProblem.String())
 	}
 }
@@ -27,10 +37,10 @@ func TestParseLog(t *testing.T) {
 	var problems []Problem
 	var times []int64
 	gameLength := 60
-	problems = append(problems, Problem{10, "*", 20})
-	problems = append(problems, Problem{100, "*", 200})
-	problems = append(problems, Problem{0, "*", 0})
-	problems = append(problems, Problem{90, "-", 1000})
+	problems = append(problems, Problem{FirstNum: 10, Operation: "*", SecondNum: 20})
+	problems = append(problems, Problem{FirstNum: 100, Operation: "*", SecondNum: 200})
+	problems = append(problems, Problem{FirstNum: 0, Operation: "*", SecondNum: 0})
+	problems = append(problems, Problem{FirstNum: 90, Operation: "-", SecondNum: 1000})
 	times = append(times, 500)
 	times = append(times, 200000)
 	times = append(times, 20)
@@ -38,9 +48,12 @@ func TestParseLog(t *testing.T) {
 	times = append(times, -1)
 	wantLog := NewLog(problems, times, gameLength)
 
-	gotLog := ParseLog(wantLog.String())
-	if wantLog.LogTime.Sub(gotLog.LogTime).Abs().Milliseconds() < 100 {
-		t.Errorf("Failed parsing log time: %s and %s", wantLog.LogTime.String(), wantLog.LogTime.String())
+	gotLog, err := ParseLog(wantLog.String())
+	if err != nil {
+		t.Fatalf("Failed parsing log: %v", err)
+	}
+	if !wantLog.LogTime.Equal(gotLog.LogTime) {
+		t.Errorf("Failed parsing log time: %s and %s", wantLog.LogTime.String(), gotLog.LogTime.String())
 	}
 	if !reflect.DeepEqual(wantLog.Problems, gotLog.Problems) {
 		t.Errorf("Failed parsing log problems: %v and %v", wantLog.Problems, gotLog.Problems)
@@ -54,27 +67,1993 @@ func TestParseLog(t *testing.T) {
 
 }
 
+func TestParseLogConfig(t *testing.T) {
+	config := GetZetamacConfig()
+	wantLog := NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}}, nil, config.Duration)
+	wantLog.ConfigName = config.Name
+	wantLog.ConfigFingerprint = config.Fingerprint()
+	wantLog.Seed = 12345
+
+	gotLog, err := ParseLog(wantLog.String())
+	if err != nil {
+		t.Fatalf("Failed parsing log: %v", err)
+	}
+	if gotLog.Seed != wantLog.Seed {
+		t.Errorf("Failed parsing log seed: %d and %d", wantLog.Seed, gotLog.Seed)
+	}
+	if gotLog.ConfigName != wantLog.ConfigName || gotLog.ConfigFingerprint != wantLog.ConfigFingerprint {
+		t.Errorf("Failed parsing log config: %s %s and %s %s", wantLog.ConfigName, wantLog.ConfigFingerprint, gotLog.ConfigName, gotLog.ConfigFingerprint)
+	}
+	if !gotLog.matchesConfig("default") || !gotLog.matchesConfig(config.Fingerprint()) || gotLog.matchesConfig("custom") {
+		t.Errorf("Log config filter mismatch for %s", gotLog.ConfigName)
+	}
+}
+
+func TestConfigFingerprint(t *testing.T) {
+	config := GetZetamacConfig()
+	renamed := GetZetamacConfig()
+	renamed.Name = "renamed"
+	renamed.Duration = 60
+	if config.Fingerprint() != renamed.Fingerprint() {
+		t.Errorf("Fingerprint depends on name or duration")
+	}
+	changed := GetZetamacConfig()
+	changed.MultiplicationConfig.MaxLeft = 20
+	if config.Fingerprint() == changed.Fingerprint() {
+		t.Errorf("Fingerprint ignores operand ranges")
+	}
+}
+
+func TestParseLegacyLog(t *testing.T) {
+	line := "1700000000 120 7 * 8 1500 12 + 30 900 9 / 3 -1\r\n"
+	gotLog, err := ParseLog(line)
+	if err != nil {
+		t.Fatalf("Failed parsing legacy log: %v", err)
+	}
+	if gotLog.Version != 1 {
+		t.Errorf("Legacy log parsed with version %d", gotLog.Version)
+	}
+	if gotLog.LogTime.Unix() != 1700000000 || gotLog.GameLength != 120 {
+		t.Errorf("Failed parsing legacy log header: %s %d", gotLog.LogTime.String(), gotLog.GameLength)
+	}
+	wantProblems := []Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 12, Operation: "+", SecondNum: 30}, {FirstNum: 9, Operation: "/", SecondNum: 3}}
+	wantTimes := []int64{1500, 900, -1}
+	if !reflect.DeepEqual(wantProblems, gotLog.Problems) || !reflect.DeepEqual(wantTimes, gotLog.Times) {
+		t.Errorf("Failed parsing legacy log: %v %v", gotLog.Problems, gotLog.Times)
+	}
+}
+
+func TestMigrateScores(t *testing.T) {
+	path := t.TempDir() + "/scores.txt"
+	legacy := "1700000000 120 7 * 8 1500 12 + 30 -1\r\n\r\n1700000500 60 5 - 2 700 6 * 6 -1\r\n"
+	os.WriteFile(path, []byte(legacy), 0644)
+
+	wantLogs, err := readLogs(path)
+	if err != nil {
+		t.Fatalf("Failed reading legacy log: %v", err)
+	}
+	err = migrateScores(path)
+	if err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	gotLogs, err := readLogs(path)
+	if err != nil {
+		t.Fatalf("Failed reading migrated log: %v", err)
+	}
+
+	if len(gotLogs) != len(wantLogs) {
+		t.Fatalf("Migration changed number of games: wanted %d, got %d", len(wantLogs), len(gotLogs))
+	}
+	for i := range gotLogs {
+		if gotLogs[i].Version != LogVersion {
+			t.Errorf("Game %d not migrated: version %d", i, gotLogs[i].Version)
+		}
+		if !gotLogs[i].LogTime.Equal(wantLogs[i].LogTime) || gotLogs[i].GameLength != wantLogs[i].GameLength {
+			t.Errorf("Game %d header changed: %v and %v", i, wantLogs[i], gotLogs[i])
+		}
+		if !reflect.DeepEqual(gotLogs[i].Problems, wantLogs[i].Problems) || !reflect.DeepEqual(gotLogs[i].Times, wantLogs[i].Times) {
+			t.Errorf("Game %d problems changed: %v and %v", i, wantLogs[i], gotLogs[i])
+		}
+	}
+	if got, _ := os.ReadFile(path + ".bak"); string(got) != legacy {
+		t.Errorf("Migration did not keep a backup of the original log")
+	}
+
+	//migrating again has nothing to do and leaves the backup alone
+	err = migrateScores(path)
+	if got, _ := os.ReadFile(path + ".bak"); err != nil || string(got) != legacy || fileExists(path+".bak.1") {
+		t.Errorf("Second migration touched the backup: %v", err)
+	}
+	//new legacy lines get a backup of their own
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.WriteString("1700000900 60 2 + 2 500\r\n")
+	file.Close()
+	err = migrateScores(path)
+	if got, _ := os.ReadFile(path + ".bak"); err != nil || string(got) != legacy || !fileExists(path+".bak.1") {
+		t.Errorf("Migration overwrote an earlier backup: %v", err)
+	}
+}
+
 func TestLoadZetamacConfig(t *testing.T) {
 	var config Config
-	config.Load("test/configs/zetamac.txt")
+	err := config.Load("test/configs/zetamac.txt")
+	if err != nil {
+		t.Fatalf("Failed loading zetamac config: %v", err)
+	}
 	if !reflect.DeepEqual(config, GetZetamacConfig()) {
 		t.Errorf("Failed loading zetamac config: wanted %s, got %s", GetZetamacConfig().String(), config.String())
 	}
 }
 
+// operations.txt enables some of the operations added after the original
+// four, leaving out the settings of one of them.
+func TestLoadOperationsConfig(t *testing.T) {
+	var config Config
+	err := config.Load("test/configs/operations.txt")
+	if err != nil {
+		t.Fatalf("Failed loading operations config: %v", err)
+	}
+	if settingsFor[SquareConfig](config, OpSquare) != (SquareConfig{11, 19}) {
+		t.Errorf("Wrong square settings: %v", config.Settings)
+	}
+	if settingsFor[PercentConfig](config, OpPercent) != (PercentConfig{10, 50, 20, 200}) {
+		t.Errorf("Wrong percent settings: %v", config.Settings)
+	}
+	if settingsFor[ModuloConfig](config, OpModulo) != settingsFor[ModuloConfig](GetZetamacConfig(), OpModulo) {
+		t.Errorf("Missing modulo settings weren't filled in: %v", config.Settings)
+	}
+	if err := validateConfig(&config); err != nil {
+		t.Errorf("Operations config rejected: %v", err)
+	}
+}
+
 func TestSaveAndLoadConfig(t *testing.T) {
 	add := AdditionConfig{5, 100, 2, 600}
 	sub := SubtractionConfig{4, 90, 30, 60, false}
 	mult := MultiplicationConfig{1, 8, 2, 50}
-	div := DivisionConfig{6, 2000, 30, 6000, false}
-	wantConfig := Config{"custom", add, sub, mult, div, false, true, 69, []string{"*", "-"}}
+	div := DivisionConfig{6, 2000, 30, 6000, false, DivisionDecimal, 3}
+	wantConfig := Config{
+		Name:                      "custom",
+		AdditionConfig:            add,
+		SubtractionConfig:         sub,
+		MultiplicationConfig:      mult,
+		DivisionConfig:            div,
+		OverrideSubtractionConfig: false,
+		OverrideDivisionConfig:    true,
+		Duration:                  69,
+		LegalOperations:           []string{"*", "-"},
+		Weights:                   map[string]int{"*": 3},
+		Settings:                  GetZetamacConfig().Settings,
+	}
 
 	os.Remove("test/configs/custom.txt")
-	wantConfig.Save("test/configs/custom.txt")
+	err := wantConfig.Save("test/configs/custom.txt")
+	if err != nil {
+		t.Fatalf("Failed saving config: %v", err)
+	}
 	var gotConfig Config
-	gotConfig.Load("test/configs/custom.txt")
+	err = gotConfig.Load("test/configs/custom.txt")
+	if err != nil {
+		t.Fatalf("Failed loading config: %v", err)
+	}
 
 	if !reflect.DeepEqual(wantConfig, gotConfig) {
 		t.Errorf("Save/Load config failed: wanted %s, got %s", wantConfig.String(), gotConfig.String())
 	}
 }
+
+func TestSetupConfigReportsMissingDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/configs", nil, 0644)
+	if err := setupConfig(Paths{DataDir: dir, ConfigDir: dir + "/configs"}); err == nil {
+		t.Errorf("Expected an error setting up a config where the config dir is a file")
+	}
+}
+
+func TestResaveConfigOverwrites(t *testing.T) {
+	path := t.TempDir() + "/config.txt"
+	config := GetZetamacConfig()
+	config.Save(path)
+	config.Duration = 30
+	err := config.Save(path)
+	if err != nil {
+		t.Fatalf("Failed saving config: %v", err)
+	}
+
+	var gotConfig Config
+	err = gotConfig.Load(path)
+	if err != nil || gotConfig.Duration != 30 {
+		t.Errorf("Re-saved config did not round trip: %v %s", err, gotConfig.String())
+	}
+}
+
+func TestLoadMissingConfig(t *testing.T) {
+	path := t.TempDir() + "/typo.txt"
+	var config Config
+	if err := config.Load(path); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist error, got %v", err)
+	}
+	if fileExists(path) {
+		t.Errorf("Loading a missing config created it")
+	}
+	os.WriteFile(path, []byte("{not json"), 0644)
+	if err := config.Load(path); err == nil {
+		t.Errorf("Expected error loading malformed config")
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, problem := range []string{"", "7 *", "7 * x", "a + 2", "1 + 2 +", "1 + 2 + x", "(1 + 2) * x", "1 foo 2 bar 3", "(1 + 2 * 3", "1 + (2 * 3)", "((1 + 2) * 3", "(1 + 2)) * 3"} {
+		if _, err := ParseProblem(problem); err == nil {
+			t.Errorf("Expected error parsing problem %q", problem)
+		}
+	}
+	for _, line := range []string{"garbage", "1700000000 120 7 * 8", `{"version":2,"problems":["7 *"]}`, `{"version":99}`, "{"} {
+		if _, err := ParseLog(line); err == nil {
+			t.Errorf("Expected error parsing log %q", line)
+		}
+	}
+}
+
+func TestReadLogsSkipsCorruptLines(t *testing.T) {
+	path := t.TempDir() + "/scores.txt"
+	good := NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}}, []int64{900}, 120).String()
+	os.WriteFile(path, []byte(good+"not a log\r\n"+good+"{\"version\":2,\"problems\":[\"1 +\"]}\r\n{\"version\":2,\"problems\":[\"1 foo 2 bar 3\"]}\r\n"), 0644)
+
+	logs, err := readLogs(path)
+	if len(logs) != 2 {
+		t.Errorf("Expected 2 good games, got %d", len(logs))
+	}
+	var corrupt *CorruptLogError
+	if !errors.As(err, &corrupt) || !reflect.DeepEqual(corrupt.Lines, []int{2, 4, 5}) {
+		t.Errorf("Expected corrupt lines 2, 4 and 5, got %v", err)
+	}
+	if err := migrateScores(path); err == nil {
+		t.Errorf("Migration should refuse to drop corrupt lines")
+	}
+}
+
+func TestSolveTimesByOperation(t *testing.T) {
+	logs := []Log{
+		NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 12, Operation: "+", SecondNum: 30}, {FirstNum: 56, Operation: "/", SecondNum: 8}}, []int64{1500, 900}, 120),
+		NewLog([]Problem{{FirstNum: 6, Operation: "*", SecondNum: 6}, {FirstNum: 40, Operation: "-", SecondNum: 2}}, []int64{700, -1}, 120),
+	}
+	got := SolveTimesByOperation(logs)
+	want := map[string][]int64{"*": {1500, 700}, "+": {900}}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Failed grouping solve times: wanted %v, got %v", want, got)
+	}
+	if ops := sortedOperations(got); !reflect.DeepEqual(ops, []string{"+", "*"}) {
+		t.Errorf("Operations out of order: %v", ops)
+	}
+}
+
+func TestSlowestFacts(t *testing.T) {
+	logs := []Log{
+		NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 6, Operation: "*", SecondNum: 6}, {FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 2, Operation: "+", SecondNum: 2}}, []int64{3000, 500, 2000}, 120),
+		NewLog([]Problem{{FirstNum: 12, Operation: "*", SecondNum: 12}, {FirstNum: 6, Operation: "*", SecondNum: 6}}, []int64{1000, 700}, 120),
+	}
+	byFact := SolveTimesByFact(logs, "*")
+	if len(byFact) != 3 || len(byFact[Fact{7, 8}]) != 2 {
+		t.Fatalf("Failed grouping facts: %v", byFact)
+	}
+	want := []Fact{{7, 8}, {12, 12}}
+	if got := slowestFacts(byFact, 2); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wrong slowest facts: wanted %v, got %v", want, got)
+	}
+}
+
+func TestEstimateDifficulty(t *testing.T) {
+	logs := []Log{
+		NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 6, Operation: "*", SecondNum: 6}, {FirstNum: 7, Operation: "*", SecondNum: 8}}, []int64{3000, 1000}, 120),
+		NewLog([]Problem{{FirstNum: 6, Operation: "*", SecondNum: 6}, {FirstNum: 9, Operation: "*", SecondNum: 9}}, []int64{1000, -1}, 120),
+	}
+	difficulty := EstimateDifficulty(logs)
+	//median of 3000, 1000, 1000 is 1000, so the two misses count 2000 each
+	if got := difficulty.Estimate(Problem{FirstNum: 7, Operation: "*", SecondNum: 8}); got != (3000+2000+1000)/3 {
+		t.Errorf("Wrong difficulty for 7 * 8: %d", got)
+	}
+	if got := difficulty.Estimate(Problem{FirstNum: 6, Operation: "*", SecondNum: 6}); got != 1000 {
+		t.Errorf("Wrong difficulty for 6 * 6: %d", got)
+	}
+	if got := difficulty.Estimate(Problem{FirstNum: 2, Operation: "+", SecondNum: 2}); got != 1000 {
+		t.Errorf("Unseen fact should get the median, got %d", got)
+	}
+}
+
+func TestAdaptiveSourceFavorsSlowFacts(t *testing.T) {
+	config := GetZetamacConfig()
+	config.LegalOperations = []string{"*"}
+	config.MultiplicationConfig = MultiplicationConfig{2, 3, 5, 5}
+	var problems []Problem
+	var times []int64
+	for i := 0; i < 20; i++ {
+		problems = append(problems, Problem{FirstNum: 2, Operation: "*", SecondNum: 5}, Problem{FirstNum: 3, Operation: "*", SecondNum: 5})
+		times = append(times, 500, 8000)
+	}
+	source := adaptiveSource{dealer: newDealer(config, newRand(1)), difficulty: EstimateDifficulty([]Log{NewLog(problems, times, 120)})}
+
+	slow := 0
+	for i := 0; i < 1000; i++ {
+		if reflect.DeepEqual(source.Next(), Problem{FirstNum: 3, Operation: "*", SecondNum: 5}) {
+			slow++
+		}
+	}
+	if slow < 800 {
+		t.Errorf("Adaptive source picked the slow fact only %d/1000 times", slow)
+	}
+}
+
+func TestDeckReview(t *testing.T) {
+	deck := Deck{Cards: make(map[string]*Card)}
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	problem := Problem{FirstNum: 7, Operation: "*", SecondNum: 8}
+
+	wantIntervals := []int{1, 6, 16}
+	for _, want := range wantIntervals {
+		card := deck.Review(problem, "default", 5, now)
+		if card.Interval != want {
+			t.Errorf("Wrong interval after %d reviews: wanted %d, got %d", card.Repetitions, want, card.Interval)
+		}
+	}
+	card := deck.Review(problem, "default", gradeSolveTime(9000), now)
+	if card.Interval != 1 || card.Repetitions != 0 {
+		t.Errorf("Failed recall should reset the card, got interval %d reps %d", card.Interval, card.Repetitions)
+	}
+	if !card.Due.Equal(now.AddDate(0, 0, 1)) {
+		t.Errorf("Wrong due date %s", card.Due)
+	}
+}
+
+func TestPracticeSourceServesDueFactsFirst(t *testing.T) {
+	scoresPath := t.TempDir() + "/scores.txt"
+	now := time.Now()
+	deck := Deck{Cards: make(map[string]*Card)}
+	deck.Review(Problem{FirstNum: 3, Operation: "*", SecondNum: 4}, "default", 5, now.AddDate(0, 0, -3))
+	deck.Review(Problem{FirstNum: 6, Operation: "*", SecondNum: 7}, "default", 5, now.AddDate(0, 0, -2))
+	deck.Review(Problem{FirstNum: 8, Operation: "*", SecondNum: 9}, "default", 5, now)
+	deck.Review(Problem{FirstNum: 2, Operation: "+", SecondNum: 2}, "other", 5, now.AddDate(0, 0, -3))
+	deck.Save(srsPath(scoresPath))
+
+	config := GetZetamacConfig()
+	source, err := newPracticeSource(config, scoresPath, nil)
+	if err != nil {
+		t.Fatalf("Failed loading practice deck: %v", err)
+	}
+	if got := source.Next(); !reflect.DeepEqual(got, Problem{FirstNum: 3, Operation: "*", SecondNum: 4}) {
+		t.Errorf("Expected most overdue fact first, got %s", got)
+	}
+	if got := source.Next(); !reflect.DeepEqual(got, Problem{FirstNum: 6, Operation: "*", SecondNum: 7}) {
+		t.Errorf("Expected second due fact, got %s", got)
+	}
+	if err := source.Record(Problem{FirstNum: 6, Operation: "*", SecondNum: 7}, 1000); err != nil {
+		t.Fatalf("Failed recording review: %v", err)
+	}
+	key := cardKey("default", Problem{FirstNum: 6, Operation: "*", SecondNum: 7})
+	if deck, err := LoadDeck(srsPath(scoresPath)); err != nil || deck.Cards[key].Repetitions != 2 {
+		t.Errorf("Review was not saved: %v %v", deck.Cards[key], err)
+	}
+}
+
+func TestDeckKeepsCardsPerConfig(t *testing.T) {
+	now := time.Now()
+	problem := Problem{FirstNum: 6, Operation: "*", SecondNum: 7}
+	deck := Deck{Cards: make(map[string]*Card)}
+	deck.Review(problem, "default", 5, now)
+	deck.Review(problem, "hard", 0, now)
+	if len(deck.Due("default", now.AddDate(0, 0, 1))) != 1 || len(deck.Due("hard", now.AddDate(0, 0, 1))) != 1 {
+		t.Errorf("A fact practised under two configs should have a card in each: %v", deck.Cards)
+	}
+
+	//decks saved before cards were kept per config are keyed by fact alone
+	path := t.TempDir() + "/srs.json"
+	old, _ := json.Marshal(map[string]map[string]*Card{"Cards": {"6 * 7": {Problem: problem, Config: "hard", Ease: 2.5, Due: now}}})
+	os.WriteFile(path, old, 0644)
+	loaded, err := LoadDeck(path)
+	if err != nil || loaded.Cards[cardKey("hard", problem)] == nil || len(loaded.Cards) != 1 {
+		t.Errorf("Old deck wasn't rekeyed by config: %v (%v)", loaded.Cards, err)
+	}
+}
+
+func TestPracticeDeckErrors(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/srs.json", []byte("{not json"), 0644)
+	if _, err := newPracticeSource(GetZetamacConfig(), dir+"/scores.txt", nil); err == nil {
+		t.Errorf("Expected error loading corrupt practice deck")
+	}
+
+	other := t.TempDir()
+	source, err := newPracticeSource(GetZetamacConfig(), other+"/scores.txt", nil)
+	if err != nil {
+		t.Fatalf("Missing practice deck should just be empty: %v", err)
+	}
+	//a non-empty directory where the deck goes can't be replaced, so saving fails
+	os.MkdirAll(other+"/srs.json/blocked", 0755)
+	if err := source.Record(Problem{FirstNum: 6, Operation: "*", SecondNum: 7}, 1000); err == nil {
+		t.Errorf("Expected error saving practice review")
+	}
+}
+
+func TestNormalizedScore(t *testing.T) {
+	log := NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 6, Operation: "*", SecondNum: 6}, {FirstNum: 2, Operation: "+", SecondNum: 2}}, []int64{1000, 2000}, 60)
+	if log.Score() != 2 {
+		t.Errorf("Wrong score %d", log.Score())
+	}
+	if log.NormalizedScore() != 4 {
+		t.Errorf("Wrong normalized score %f", log.NormalizedScore())
+	}
+	if got := sparkline([]float64{10, 20, 30}); got != "▁▄█" {
+		t.Errorf("Wrong sparkline %s", got)
+	}
+}
+
+func TestSeededGenerationIsReproducible(t *testing.T) {
+	config := GetZetamacConfig()
+	config.Seed = 42
+	first := newProblemSource(config, nil)
+	second := newProblemSource(config, nil)
+	for i := 0; i < 100; i++ {
+		want, got := first.Next(), second.Next()
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("Seeded sources diverged at problem %d: %s and %s", i, want, got)
+		}
+	}
+
+	config.Seed = 43
+	other := newProblemSource(config, nil)
+	unseeded := newProblemSource(GetZetamacConfig(), nil)
+	same := true
+	for i := 0; i < 20; i++ {
+		if !reflect.DeepEqual(other.Next(), unseeded.Next()) {
+			same = false
+		}
+	}
+	if same {
+		t.Errorf("Different seeds produced the same sequence")
+	}
+}
+
+func TestProblemAnswer(t *testing.T) {
+	cases := []struct {
+		problem Problem
+		want    int
+		err     error
+	}{
+		{Problem{FirstNum: 12, Operation: "+", SecondNum: 30}, 42, nil},
+		{Problem{FirstNum: 5, Operation: "-", SecondNum: 9}, -4, nil},
+		{Problem{FirstNum: 7, Operation: "*", SecondNum: 8}, 56, nil},
+		{Problem{FirstNum: 56, Operation: "/", SecondNum: 8}, 7, nil},
+		{Problem{FirstNum: 7, Operation: "/", SecondNum: 2}, 3, nil},
+		{Problem{FirstNum: -7, Operation: "/", SecondNum: 2}, -3, nil},
+		{Problem{FirstNum: math.MaxInt/2 + 1, Operation: "+", SecondNum: math.MaxInt / 2}, math.MaxInt, nil},
+		{Problem{FirstNum: math.MaxInt/2 + 1, Operation: "+", SecondNum: math.MaxInt/2 + 1}, 0, ErrOverflow},
+		{Problem{FirstNum: math.MaxInt - 1, Operation: "*", SecondNum: 1}, math.MaxInt - 1, nil},
+		{Problem{FirstNum: math.MaxInt / 2, Operation: "*", SecondNum: 3}, 0, ErrOverflow},
+		{Problem{FirstNum: math.MinInt, Operation: "/", SecondNum: -1}, 0, ErrOverflow},
+		{Problem{FirstNum: 5, Operation: "/", SecondNum: 0}, 0, ErrDivisionByZero},
+	}
+	for _, c := range cases {
+		got, err := c.problem.Answer()
+		if got != c.want || err != c.err {
+			t.Errorf("Wrong answer for %s: wanted %d %v, got %d %v", c.problem, c.want, c.err, got, err)
+		}
+	}
+}
+
+func FuzzProblemAnswer(f *testing.F) {
+	f.Add(7, uint8(2), 8)
+	f.Add(math.MaxInt, uint8(0), 1)
+	f.Add(math.MinInt, uint8(1), 1)
+	f.Add(math.MaxInt/2, uint8(2), 3)
+	f.Add(math.MinInt, uint8(3), -1)
+	f.Add(-7, uint8(3), 2)
+	operations := []string{"+", "-", "*", "/"}
+	f.Fuzz(func(t *testing.T, a int, op uint8, b int) {
+		problem := Problem{FirstNum: a, Operation: operations[int(op)%len(operations)], SecondNum: b}
+		got, err := problem.Answer()
+
+		bigA, bigB := big.NewInt(int64(a)), big.NewInt(int64(b))
+		want := new(big.Int)
+		switch problem.Operation {
+		case "+":
+			want.Add(bigA, bigB)
+		case "-":
+			want.Sub(bigA, bigB)
+		case "*":
+			want.Mul(bigA, bigB)
+		case "/":
+			if b == 0 {
+				if err != ErrDivisionByZero {
+					t.Fatalf("%s: wanted division by zero, got %d %v", problem, got, err)
+				}
+				return
+			}
+			want.Quo(bigA, bigB)
+		}
+
+		if !want.IsInt64() {
+			if err != ErrOverflow {
+				t.Fatalf("%s: wanted overflow, got %d %v", problem, got, err)
+			}
+			return
+		}
+		if err != nil || int64(got) != want.Int64() {
+			t.Fatalf("%s: wanted %s, got %d %v", problem, want, got, err)
+		}
+	})
+}
+
+func TestSummarizeKeystrokes(t *testing.T) {
+	//typed 54, deleted the 4, then finished 56
+	keystrokes := []Keystroke{{1200, "5"}, {1400, "54"}, {1900, "5"}, {2100, "56"}}
+	got := SummarizeKeystrokes("56", keystrokes)
+	want := InputSummary{FirstKey: 1200, Backspaces: 1, WrongAnswers: 1, CorrectionTime: 700}
+	if got != want {
+		t.Errorf("Wrong keystroke summary: wanted %v, got %v", want, got)
+	}
+
+	clean := SummarizeKeystrokes("56", []Keystroke{{3000, "5"}, {3100, "56"}})
+	if clean != (InputSummary{FirstKey: 3000}) {
+		t.Errorf("Wrong keystroke summary for clean solve: %v", clean)
+	}
+
+	//22 / 7 answered with a remainder, after typing 4 and deleting it
+	remainder := SummarizeKeystrokes("3r1", []Keystroke{{1000, "4"}, {1200, ""}, {1500, "3"}, {1600, "3r"}, {1800, "3r1"}})
+	if want := (InputSummary{FirstKey: 1000, Backspaces: 1, CorrectionTime: 600}); remainder != want {
+		t.Errorf("Wrong keystroke summary for remainder answer: wanted %v, got %v", want, remainder)
+	}
+	//a wrong answer of the right length
+	wrong := SummarizeKeystrokes("3.14", []Keystroke{{500, "3"}, {600, "3."}, {700, "3.1"}, {800, "3.15"}, {1000, "3.1"}, {1100, "3.14"}})
+	if want := (InputSummary{FirstKey: 500, Backspaces: 1, WrongAnswers: 1, CorrectionTime: 300}); wrong != want {
+		t.Errorf("Wrong keystroke summary for decimal answer: wanted %v, got %v", want, wrong)
+	}
+
+	old := NewLog([]Problem{{FirstNum: 22, Operation: "/", SecondNum: 7}}, []int64{2100}, 120)
+	if correct, ok := old.ExpectedAnswer(0); !ok || correct != "3" {
+		t.Errorf("Logs without answers should expect whole numbers, got %q", correct)
+	}
+	old.Answers = []string{"3r1"}
+	if correct, ok := old.ExpectedAnswer(0); !ok || correct != "3r1" {
+		t.Errorf("Logged answer not used, got %q", correct)
+	}
+
+	log := NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}}, []int64{2100}, 120)
+	log.Keystrokes = [][]Keystroke{keystrokes}
+	gotLog, err := ParseLog(log.String())
+	if err != nil || !reflect.DeepEqual(gotLog.Keystrokes, log.Keystrokes) {
+		t.Errorf("Failed parsing log keystrokes: %v %v", err, gotLog.Keystrokes)
+	}
+}
+
+func TestRunExitCodes(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv(HomeEnv, t.TempDir())
+	scoresPath := t.TempDir() + "/scores.txt"
+	os.WriteFile(scoresPath, []byte(NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 2, Operation: "+", SecondNum: 2}}, []int64{900}, 120).String()), 0644)
+
+	cases := []struct {
+		args []string
+		want int
+	}{
+		{[]string{"bogus"}, 2},
+		{[]string{"stats", "--scores", scoresPath}, 0},
+		{[]string{"stats", "--scores", scoresPath, "extra"}, 2},
+		{[]string{"stats", "--nope"}, 2},
+		{[]string{"history", "--scores", scoresPath, "--config", "default"}, 0},
+		{[]string{"play", "--duration", "ten"}, 2},
+		{[]string{"play", "--config", "does-not-exist"}, 1},
+		{[]string{"export", "--format", "xml", "--scores", scoresPath}, 2},
+		{[]string{"migrate", "--scores", scoresPath + ".missing"}, 1},
+		{[]string{"help", "stats"}, 0},
+		{[]string{"--help"}, 0},
+	}
+	for _, c := range cases {
+		if got := run(c.args, ""); got != c.want {
+			t.Errorf("zetatrack %v exited with %d, wanted %d", c.args, got, c.want)
+		}
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(t.TempDir())
+	t.Setenv(HomeEnv, dir)
+	log := NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 2, Operation: "+", SecondNum: 2}}, []int64{900}, 120)
+	log.ConfigName = "default"
+	os.WriteFile(dir+"/scores.txt", []byte(log.String()), 0644)
+
+	if code := run([]string{"export", "--scores", dir + "/scores.txt", "--output", dir + "/out.csv"}, ""); code != 0 {
+		t.Fatalf("export exited with %d", code)
+	}
+	res, _ := os.ReadFile(dir + "/out.csv")
+	lines := strings.Split(strings.TrimSpace(string(res)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %q", res)
+	}
+	if !strings.HasSuffix(lines[1], ",default,,0,120,0,7 * 8,*,7,8,900") {
+		t.Errorf("Wrong export row %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], ",2 + 2,+,2,2,-1") {
+		t.Errorf("Wrong export row %q", lines[2])
+	}
+}
+
+func TestResolvePaths(t *testing.T) {
+	t.Setenv(HomeEnv, "")
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	paths, err := resolvePaths("")
+	if err != nil || paths.Scores() != "/xdg/data/zetatrack/scores.txt" || paths.Config("hard") != "/xdg/config/zetatrack/configs/hard.txt" {
+		t.Errorf("Wrong XDG paths: %v %v", paths, err)
+	}
+
+	t.Setenv("XDG_DATA_HOME", "relative")
+	t.Setenv("HOME", "/home/me")
+	paths, _ = resolvePaths("")
+	if paths.DataDir != "/home/me/.local/share/zetatrack" {
+		t.Errorf("Relative XDG_DATA_HOME should be ignored, got %s", paths.DataDir)
+	}
+
+	t.Setenv(HomeEnv, "/env/home")
+	if paths, _ = resolvePaths(""); paths.Scores() != "/env/home/scores.txt" || paths.ConfigDir != "/env/home/configs" {
+		t.Errorf("Wrong %s paths: %v", HomeEnv, paths)
+	}
+	if paths, _ = resolvePaths("/flag/home"); paths.DataDir != "/flag/home" {
+		t.Errorf("--data-dir should win over %s, got %v", HomeEnv, paths)
+	}
+}
+
+func TestMigrateWorkingDirFiles(t *testing.T) {
+	cwd := t.TempDir()
+	paths := Paths{DataDir: t.TempDir() + "/data", ConfigDir: t.TempDir() + "/configs"}
+	scores := "1700000000 120 7 * 8 1500\n"
+	hard, _ := json.Marshal(hardPreset())
+	os.WriteFile(cwd+"/scores.txt", []byte(scores), 0644)
+	os.Mkdir(cwd+"/configs", 0755)
+	os.WriteFile(cwd+"/configs/hard.txt", hard, 0644)
+	os.WriteFile(cwd+"/configs/default.txt", hard, 0644)
+	//files that aren't zetatrack's stay where they are
+	os.WriteFile(cwd+"/configs/notes.txt", []byte("remember the milk"), 0644)
+	os.WriteFile(cwd+"/configs/other.txt", []byte(`{"Name":"x","Port":80}`), 0644)
+	os.WriteFile(cwd+"/srs.json", []byte(`{"name":"someone else's"}`), 0644)
+	os.MkdirAll(paths.ConfigDir, 0755)
+	os.WriteFile(paths.Config("default"), []byte("new default"), 0644)
+
+	err := migrateWorkingDirFiles(cwd, paths)
+	if err != nil {
+		t.Fatalf("Migration failed: %v", err)
+	}
+	for path, want := range map[string]string{paths.Scores(): scores, paths.Config("hard"): string(hard), paths.Config("default"): "new default"} {
+		if got, _ := os.ReadFile(path); string(got) != want {
+			t.Errorf("Wrong contents in %s: wanted %q, got %q", path, want, got)
+		}
+	}
+	if fileExists(cwd+"/scores.txt") || fileExists(cwd+"/configs/hard.txt") {
+		t.Errorf("Migrated files were left behind")
+	}
+	if !fileExists(cwd + "/configs/default.txt") {
+		t.Errorf("Config that already existed in the config dir should stay put")
+	}
+	for _, path := range []string{cwd + "/configs/notes.txt", cwd + "/configs/other.txt", cwd + "/srs.json"} {
+		if !fileExists(path) {
+			t.Errorf("Moved %s, which isn't zetatrack's", path)
+		}
+	}
+
+	//once the data directory exists nothing more is moved
+	os.WriteFile(cwd+"/configs/later.txt", hard, 0644)
+	err = migrateWorkingDirFiles(cwd, paths)
+	if err != nil || !fileExists(cwd+"/configs/later.txt") {
+		t.Errorf("Migrated again after the first run: %v", err)
+	}
+}
+
+func TestRunContinuesAfterFailedMigration(t *testing.T) {
+	legacy := t.TempDir()
+	hard, _ := json.Marshal(hardPreset())
+	os.Mkdir(legacy+"/configs", 0755)
+	os.WriteFile(legacy+"/configs/hard.txt", hard, 0644)
+	home := t.TempDir()
+	t.Setenv(HomeEnv, "")
+	t.Setenv("XDG_DATA_HOME", home+"/data")
+	//a file where the config directory should be makes the move fail
+	os.WriteFile(home+"/config", nil, 0644)
+	t.Setenv("XDG_CONFIG_HOME", home+"/config")
+	if code := run([]string{"help"}, legacy); code != 0 {
+		t.Errorf("help exited with %d after a failed migration", code)
+	}
+	if !fileExists(legacy + "/configs/hard.txt") {
+		t.Errorf("Config was lost in a failed migration")
+	}
+}
+
+func TestRunKeepsLegacyFilesWithExplicitHome(t *testing.T) {
+	legacy := t.TempDir()
+	os.WriteFile(legacy+"/scores.txt", []byte("old scores"), 0644)
+	os.Mkdir(legacy+"/configs", 0755)
+	os.WriteFile(legacy+"/configs/mine.txt", []byte("{}"), 0644)
+	t.Setenv(HomeEnv, t.TempDir())
+	if code := run([]string{"list-configs"}, legacy); code != 0 {
+		t.Fatalf("list-configs exited with %d", code)
+	}
+	t.Setenv(HomeEnv, "")
+	if code := run([]string{"--data-dir", t.TempDir(), "list-configs"}, legacy); code != 0 {
+		t.Fatalf("list-configs exited with %d", code)
+	}
+	if !fileExists(legacy+"/scores.txt") || !fileExists(legacy+"/configs/mine.txt") {
+		t.Errorf("Files were moved out of the working directory into an explicit data directory")
+	}
+}
+
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) After(d time.Duration) <-chan time.Time {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- clock.now
+		return ch
+	}
+	clock.timers = append(clock.timers, fakeTimer{clock.now.Add(d), ch})
+	return ch
+}
+
+// Advance moves the clock forward, firing every timer that comes due.
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mu.Lock()
+	defer clock.mu.Unlock()
+	clock.now = clock.now.Add(d)
+	var pending []fakeTimer
+	for _, timer := range clock.timers {
+		if timer.at.After(clock.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- clock.now
+	}
+	clock.timers = pending
+}
+
+type scriptedInput struct {
+	keys  chan KeyEvent
+	clock *fakeClock
+	start time.Time
+}
+
+func (input *scriptedInput) Keys() <-chan KeyEvent {
+	return input.keys
+}
+
+// typeAt presses each key of text offset from the game's start.
+func (input *scriptedInput) typeAt(text string, offset time.Duration) {
+	for _, key := range text {
+		input.keys <- KeyEvent{key, input.start.Add(offset)}
+	}
+}
+
+type recordingRenderer struct {
+	problems []Problem
+	answers  []string
+	score    int
+	finished int
+	//statuses, if set, receives every status shown
+	statuses chan Status
+}
+
+func (renderer *recordingRenderer) Start(config Config) {}
+
+func (renderer *recordingRenderer) ShowProblem(problem Problem) {
+	renderer.problems = append(renderer.problems, problem)
+}
+
+func (renderer *recordingRenderer) ShowAnswer(problem Problem, answer string) {
+	renderer.answers = append(renderer.answers, answer)
+}
+
+func (renderer *recordingRenderer) ShowStatus(status Status) {
+	if renderer.statuses != nil {
+		renderer.statuses <- status
+	}
+}
+
+func (renderer *recordingRenderer) Finish(score int) {
+	renderer.score = score
+	renderer.finished++
+}
+
+func startScriptedGame(ctx context.Context, config Config) (*scriptedInput, *recordingRenderer, chan Log) {
+	clock := newFakeClock()
+	input := &scriptedInput{keys: make(chan KeyEvent), clock: clock, start: clock.Now()}
+	renderer := &recordingRenderer{}
+	game := Game{Config: config, Source: newProblemSource(config, nil), Input: input, Renderer: renderer, Clock: clock}
+	done := make(chan Log)
+	go func() {
+		log, _ := game.Run(ctx)
+		done <- log
+	}()
+	return input, renderer, done
+}
+
+func TestGameEndToEnd(t *testing.T) {
+	config := GetZetamacConfig()
+	config.Seed = 7
+	config.Duration = 30
+	expected := newProblemSource(config, nil)
+	first, second := expected.Next(), expected.Next()
+	firstAns, secondAns := strconv.Itoa(getProblemAnswer(first)), strconv.Itoa(getProblemAnswer(second))
+
+	input, renderer, done := startScriptedGame(context.Background(), config)
+	//a typo on the first problem, fixed with a backspace
+	input.typeAt("x", 500*time.Millisecond)
+	input.typeAt("9", 1000*time.Millisecond)
+	input.typeAt(string(KeyBackspace), 1500*time.Millisecond)
+	input.typeAt(firstAns, 2000*time.Millisecond)
+	input.typeAt(secondAns, 3500*time.Millisecond)
+	input.clock.Advance(30 * time.Second)
+	log := <-done
+
+	if renderer.finished != 1 || renderer.score != 2 {
+		t.Errorf("Game finished %d times with score %d, wanted once with score 2", renderer.finished, renderer.score)
+	}
+	if len(log.Problems) != 3 || !reflect.DeepEqual(log.Problems[:2], []Problem{first, second}) {
+		t.Fatalf("Wrong problems logged: %v", log.Problems)
+	}
+	if !reflect.DeepEqual(log.Times, []int64{2000, 1500, -1}) {
+		t.Errorf("Wrong solve times: %v", log.Times)
+	}
+	if len(log.Answers) != 3 || !reflect.DeepEqual(log.Answers[:2], []string{firstAns, secondAns}) {
+		t.Errorf("Wrong answers logged: %v", log.Answers)
+	}
+	wantKeys := []Keystroke{{1000, "9"}, {1500, ""}}
+	for i := range firstAns {
+		wantKeys = append(wantKeys, Keystroke{2000, firstAns[:i+1]})
+	}
+	if !reflect.DeepEqual(log.Keystrokes[0], wantKeys) {
+		t.Errorf("Wrong keystrokes: wanted %v, got %v", wantKeys, log.Keystrokes[0])
+	}
+	if log.ConfigName != config.Name || log.Seed != 7 || log.GameLength != 30 {
+		t.Errorf("Wrong log metadata: %s %d %d", log.ConfigName, log.Seed, log.GameLength)
+	}
+	if !reflect.DeepEqual(renderer.problems, log.Problems) {
+		t.Errorf("Rendered problems %v don't match logged %v", renderer.problems, log.Problems)
+	}
+}
+
+func TestGameQuit(t *testing.T) {
+	config := GetZetamacConfig()
+	config.Seed = 7
+	input, renderer, done := startScriptedGame(context.Background(), config)
+	input.typeAt("q", time.Second)
+	log := <-done
+	if renderer.finished != 1 || len(log.Problems) != 1 || !reflect.DeepEqual(log.Times, []int64{-1}) {
+		t.Errorf("Quit game logged %v %v", log.Problems, log.Times)
+	}
+
+	input, renderer, done = startScriptedGame(context.Background(), config)
+	close(input.keys)
+	log = <-done
+	if renderer.finished != 1 || len(log.Problems) != 1 {
+		t.Errorf("Closed input didn't end the game: %v", log.Problems)
+	}
+}
+
+func TestGameStatus(t *testing.T) {
+	config := GetZetamacConfig()
+	config.Seed = 7
+	config.Duration = 30
+	firstAns := strconv.Itoa(getProblemAnswer(newProblemSource(config, nil).Next()))
+	//the personal best was a 60 second game, so its pace runs at double speed
+	best := NewLog(nil, []int64{1000, 1000, 2000}, 60)
+
+	clock := newFakeClock()
+	input := &scriptedInput{keys: make(chan KeyEvent), clock: clock, start: clock.Now()}
+	renderer := &recordingRenderer{statuses: make(chan Status, 100)}
+	game := Game{Config: config, Source: newProblemSource(config, nil), Input: input, Renderer: renderer, Clock: clock, Best: &best}
+	done := make(chan Log)
+	go func() {
+		log, _ := game.Run(context.Background())
+		done <- log
+	}()
+
+	expect := func(want Status) {
+		t.Helper()
+		if got := <-renderer.statuses; got != want {
+			t.Errorf("Wrong status: wanted %+v, got %+v", want, got)
+		}
+	}
+	expect(Status{30 * time.Second, 0, 0})
+	clock.Advance(time.Second)
+	expect(Status{29 * time.Second, 0, 2})
+	input.typeAt(firstAns, 1500*time.Millisecond)
+	expect(Status{29 * time.Second, 1, 2})
+	clock.Advance(time.Second)
+	expect(Status{28 * time.Second, 1, 3})
+	input.typeAt("q", 2500*time.Millisecond)
+	<-done
+}
+
+func TestPersonalBest(t *testing.T) {
+	config := GetZetamacConfig()
+	other := config
+	other.AdditionConfig.MaxLeft = 50
+	short := NewLog(nil, []int64{1000, 1000}, 30)
+	short.ConfigFingerprint = config.Fingerprint()
+	long := NewLog(nil, []int64{1000, 1000, 1000}, 120)
+	long.ConfigFingerprint = config.Fingerprint()
+	otherBest := NewLog(nil, []int64{1, 1, 1, 1, 1}, 30)
+	otherBest.ConfigFingerprint = other.Fingerprint()
+
+	best, ok := personalBest([]Log{long, short, otherBest}, config)
+	if !ok || !reflect.DeepEqual(best, short) {
+		t.Errorf("Wrong personal best: %v", best)
+	}
+	if _, ok := personalBest([]Log{short}, other); ok {
+		t.Errorf("Found a personal best for a config that was never played")
+	}
+	if got := short.ScoreAt(1999 * time.Millisecond); got != 1 {
+		t.Errorf("Wrong score part way through a game: %d", got)
+	}
+}
+
+func TestGameEndsOnceWhenEverythingHappensAtOnce(t *testing.T) {
+	config := GetZetamacConfig()
+	config.Seed = 7
+	for i := 0; i < 50; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		input, renderer, done := startScriptedGame(ctx, config)
+		go input.clock.Advance(time.Duration(config.Duration) * time.Second)
+		go cancel()
+		go func() {
+			select {
+			case input.keys <- KeyEvent{KeyInterrupt, input.start}:
+			case <-ctx.Done():
+			}
+		}()
+		log := <-done
+		if renderer.finished != 1 || len(log.Problems) != 1 {
+			t.Fatalf("Game finished %d times with %d problems", renderer.finished, len(log.Problems))
+		}
+		select {
+		case <-done:
+			t.Fatalf("Game returned twice")
+		default:
+		}
+		cancel()
+	}
+}
+
+func TestCancelledGameSavesOneLog(t *testing.T) {
+	scoresPath := t.TempDir() + "/scores.txt"
+	config := GetZetamacConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	input, _, done := startScriptedGame(ctx, config)
+	input.typeAt("1", time.Second)
+	cancel()
+	err := appendLog(scoresPath, <-done)
+	if err != nil {
+		t.Fatalf("Failed saving log: %v", err)
+	}
+	logs, err := readLogs(scoresPath)
+	if err != nil || len(logs) != 1 {
+		t.Errorf("Expected exactly one saved game, got %d (%v)", len(logs), err)
+	}
+}
+
+func TestEditAnswer(t *testing.T) {
+	answer := ""
+	for _, key := range "-1-2x" {
+		answer, _ = editAnswer(answer, key)
+	}
+	if answer != "-12" {
+		t.Errorf("Wanted a minus sign only at the start, got %q", answer)
+	}
+	answer, _ = editAnswer(answer, KeyBackspace)
+	answer, _ = editAnswer(answer, KeyBackspace)
+	if answer != "-" {
+		t.Errorf("Wanted the minus sign left after backspacing the digits, got %q", answer)
+	}
+}
+
+func TestNegativeAnswers(t *testing.T) {
+	config := GetZetamacConfig()
+	config.Seed = 3
+	config.Duration = 30
+	config.LegalOperations = []string{"-"}
+	config.OverrideSubtractionConfig = false
+	config.SubtractionConfig = SubtractionConfig{-20, -10, 5, 10, false}
+	if err := validateConfig(&config); err != nil {
+		t.Fatalf("Config with negative operands was rejected: %v", err)
+	}
+	problem := newProblemSource(config, nil).Next()
+	answer := getProblemAnswer(problem)
+	if answer >= 0 {
+		t.Fatalf("Expected a negative answer for %s, got %d", problem, answer)
+	}
+
+	input, renderer, done := startScriptedGame(context.Background(), config)
+	input.typeAt(strconv.Itoa(answer), time.Second)
+	input.typeAt("q", 2*time.Second)
+	<-done
+	if renderer.score != 1 {
+		t.Errorf("Negative answer %d to %s wasn't accepted", answer, problem)
+	}
+
+	config.SubtractionConfig.ForceNonnegativeDifference = true
+	if err := validateConfig(&config); err == nil {
+		t.Errorf("Config that can never give a non-negative difference was accepted")
+	}
+}
+
+func TestExpectedAnswer(t *testing.T) {
+	config := GetZetamacConfig()
+	tests := []struct {
+		mode    string
+		places  int
+		problem Problem
+		want    string
+	}{
+		{"", 0, Problem{FirstNum: 22, Operation: "/", SecondNum: 7}, "3"},
+		{DivisionInteger, 0, Problem{FirstNum: 22, Operation: "/", SecondNum: 7}, "3"},
+		{DivisionRemainder, 0, Problem{FirstNum: 22, Operation: "/", SecondNum: 7}, "3r1"},
+		{DivisionRemainder, 0, Problem{FirstNum: 21, Operation: "/", SecondNum: 7}, "3"},
+		{DivisionDecimal, 2, Problem{FirstNum: 22, Operation: "/", SecondNum: 7}, "3.14"},
+		{DivisionDecimal, 2, Problem{FirstNum: 1, Operation: "/", SecondNum: 8}, "0.13"},
+		{DivisionDecimal, 3, Problem{FirstNum: 5, Operation: "/", SecondNum: 4}, "1.25"},
+		{DivisionDecimal, 1, Problem{FirstNum: 39, Operation: "/", SecondNum: 4}, "9.8"},
+		{DivisionDecimal, 1, Problem{FirstNum: 20, Operation: "/", SecondNum: 21}, "1"},
+		{DivisionRemainder, 0, Problem{FirstNum: 22, Operation: "-", SecondNum: 7}, "15"},
+	}
+	for _, test := range tests {
+		config.DivisionConfig.AnswerMode = test.mode
+		config.DivisionConfig.DecimalPlaces = test.places
+		got, err := config.ExpectedAnswer(test.problem)
+		if err != nil || got != test.want {
+			t.Errorf("Wrong %s answer to %s: wanted %s, got %s (%v)", test.mode, test.problem, test.want, got, err)
+		}
+	}
+}
+
+func TestEditAnswerDivisionForms(t *testing.T) {
+	tests := map[string]string{
+		"3r1":   "3r1",
+		"r3":    "3",
+		"3.14":  "3.14",
+		"3.1.4": "3.14",
+		"3r.1":  "3r1",
+		"-.5":   "-5",
+	}
+	for keys, want := range tests {
+		answer := ""
+		for _, key := range keys {
+			answer, _ = editAnswer(answer, key)
+		}
+		if answer != want {
+			t.Errorf("Typing %q gave %q, wanted %q", keys, answer, want)
+		}
+	}
+}
+
+func TestExtraOperationsRoundTrip(t *testing.T) {
+	tests := []struct {
+		problem Problem
+		text    string
+		answer  int
+	}{
+		{Problem{FirstNum: 12, Operation: OpSquare, SecondNum: 0}, "12²", 144},
+		{Problem{FirstNum: 3, Operation: OpPower, SecondNum: 4}, "3 ^ 4", 81},
+		{Problem{FirstNum: 144, Operation: OpSquareRoot, SecondNum: 0}, "√144", 12},
+		{Problem{FirstNum: 27, Operation: OpCubeRoot, SecondNum: 0}, "∛27", 3},
+		{Problem{FirstNum: -27, Operation: OpCubeRoot, SecondNum: 0}, "∛-27", -3},
+		{Problem{FirstNum: 17, Operation: OpModulo, SecondNum: 5}, "17 mod 5", 2},
+		{Problem{FirstNum: 15, Operation: OpPercent, SecondNum: 80}, "15% of 80", 12},
+	}
+	for _, test := range tests {
+		if test.problem.String() != test.text {
+			t.Errorf("Wrong rendering: wanted %q, got %q", test.text, test.problem.String())
+		}
+		parsed, err := ParseProblem(test.text)
+		if err != nil || !reflect.DeepEqual(parsed, test.problem) {
+			t.Errorf("Couldn't parse %q: got %v (%v)", test.text, parsed, err)
+		}
+		if ans, err := test.problem.Answer(); err != nil || ans != test.answer {
+			t.Errorf("Wrong answer to %s: wanted %d, got %d (%v)", test.text, test.answer, ans, err)
+		}
+	}
+	for _, bad := range []string{"12³", "√x", "15% to 80"} {
+		if _, err := ParseProblem(bad); err == nil {
+			t.Errorf("Parsed malformed problem %q", bad)
+		}
+	}
+}
+
+func TestExtraOperationAnswerErrors(t *testing.T) {
+	tests := []struct {
+		problem Problem
+		want    error
+	}{
+		{Problem{FirstNum: -4, Operation: OpSquareRoot, SecondNum: 0}, ErrNegativeRoot},
+		{Problem{FirstNum: 2, Operation: OpPower, SecondNum: -1}, ErrNegativeExponent},
+		{Problem{FirstNum: 2, Operation: OpPower, SecondNum: 63}, ErrOverflow},
+		{Problem{FirstNum: math.MaxInt, Operation: OpSquare, SecondNum: 0}, ErrOverflow},
+		{Problem{FirstNum: 7, Operation: OpModulo, SecondNum: 0}, ErrDivisionByZero},
+	}
+	for _, test := range tests {
+		if _, err := test.problem.Answer(); !errors.Is(err, test.want) {
+			t.Errorf("Wrong error for %s: wanted %v, got %v", test.problem, test.want, err)
+		}
+	}
+	if ans, err := (Problem{FirstNum: math.MaxInt, Operation: OpSquareRoot, SecondNum: 0}).Answer(); err != nil || ans != 3037000499 {
+		t.Errorf("Wrong square root of max int: %d (%v)", ans, err)
+	}
+	if ans, err := (Problem{FirstNum: -1, Operation: OpPower, SecondNum: math.MaxInt}).Answer(); err != nil || ans != -1 {
+		t.Errorf("Wrong odd power of -1: %d (%v)", ans, err)
+	}
+}
+
+func TestGenerateExtraOperations(t *testing.T) {
+	config := GetZetamacConfig()
+	config.LegalOperations = []string{OpSquare, OpPower, OpSquareRoot, OpCubeRoot, OpModulo, OpPercent}
+	config.setSettings(OpPercent, PercentConfig{1, 99, 10, 30})
+	if err := validateConfig(&config); err != nil {
+		t.Fatalf("Default settings for extra operations rejected: %v", err)
+	}
+	squareRoots := settingsFor[RootConfig](config, OpSquareRoot)
+	cubeRoots := settingsFor[RootConfig](config, OpCubeRoot)
+	rng := newRand(11)
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		problem := genProblem(rng, config)
+		seen[problem.Operation] = true
+		ans, err := problem.Answer()
+		if err != nil {
+			t.Fatalf("Generated unanswerable problem %s: %v", problem, err)
+		}
+		switch problem.Operation {
+		case OpSquareRoot:
+			if ans*ans != problem.FirstNum || ans < squareRoots.Min || ans > squareRoots.Max {
+				t.Errorf("Square root problem %s out of range or not clean", problem)
+			}
+		case OpCubeRoot:
+			if ans*ans*ans != problem.FirstNum || ans < cubeRoots.Min || ans > cubeRoots.Max {
+				t.Errorf("Cube root problem %s out of range or not clean", problem)
+			}
+		case OpPercent:
+			if problem.FirstNum*problem.SecondNum%100 != 0 || problem.SecondNum < 10 || problem.SecondNum > 30 {
+				t.Errorf("Percent problem %s out of range or not whole", problem)
+			}
+		}
+	}
+	if len(seen) != len(config.LegalOperations) {
+		t.Errorf("Not every operation was generated: %v", seen)
+	}
+}
+
+func TestGeneratePercents(t *testing.T) {
+	//only multiples of 50 have a whole answer for bases up to 3
+	settings := PercentConfig{1, 250, 1, 3}
+	rng := newRand(3)
+	seen := map[int]int{}
+	for i := 0; i < 5000; i++ {
+		problem := genPercentProblem(rng, settings)
+		if problem.FirstNum%50 != 0 || problem.FirstNum*problem.SecondNum%100 != 0 {
+			t.Fatalf("Percent problem %s has no whole answer", problem)
+		}
+		seen[problem.FirstNum]++
+	}
+	for _, percent := range []int{50, 100, 150, 200, 250} {
+		if seen[percent] < 800 {
+			t.Errorf("%d%% came up %d times out of 5000", percent, seen[percent])
+		}
+	}
+}
+
+func TestValidateExtraOperations(t *testing.T) {
+	config := GetZetamacConfig()
+	config.LegalOperations = []string{OpPercent}
+	//no percent from 1 to 3 gives a whole answer for bases 1 to 3
+	config.setSettings(OpPercent, PercentConfig{1, 3, 1, 3})
+	if err := validateConfig(&config); err == nil {
+		t.Errorf("Percent config without whole answers was accepted")
+	}
+
+	//configs saved before the extra operations existed leave them zero
+	config = GetZetamacConfig()
+	config.setSettings(OpModulo, ModuloConfig{})
+	config.setSettings(OpPercent, PercentConfig{})
+	if err := validateConfig(&config); err != nil {
+		t.Errorf("Zero settings for disabled operations were rejected: %v", err)
+	}
+	config.LegalOperations = append(config.LegalOperations, OpModulo)
+	if err := validateConfig(&config); err == nil {
+		t.Errorf("Modulo by zero was accepted")
+	}
+	config.LegalOperations = []string{"x"}
+	if err := validateConfig(&config); err == nil {
+		t.Errorf("Unknown operation was accepted")
+	}
+
+	//10^15 is 16 digits, too long to type
+	config = GetZetamacConfig()
+	config.LegalOperations = []string{OpPower}
+	config.setSettings(OpPower, PowerConfig{2, 10, 2, 15})
+	if err := validateConfig(&config); err == nil {
+		t.Errorf("Powers too long to type were accepted")
+	}
+	config.setSettings(OpPower, PowerConfig{2, 10, 2, 9})
+	if err := validateConfig(&config); err != nil {
+		t.Errorf("Powers short enough to type were rejected: %v", err)
+	}
+	config.LegalOperations = []string{OpSquare}
+	config.setSettings(OpSquare, SquareConfig{2, 100_000})
+	if err := validateConfig(&config); err == nil {
+		t.Errorf("Squares too long to type were accepted")
+	}
+}
+
+func TestFingerprintIgnoresDisabledOperations(t *testing.T) {
+	config := GetZetamacConfig()
+	changed := GetZetamacConfig()
+	changed.setSettings(OpPower, PowerConfig{2, 10, 2, 9})
+	if config.Fingerprint() != changed.Fingerprint() {
+		t.Errorf("Fingerprint depends on settings of a disabled operation")
+	}
+	changed.LegalOperations = append(changed.LegalOperations, OpPower)
+	config.LegalOperations = append(config.LegalOperations, OpPower)
+	if config.Fingerprint() == changed.Fingerprint() {
+		t.Errorf("Fingerprint ignores settings of an enabled operation")
+	}
+}
+
+func TestChainRoundTrip(t *testing.T) {
+	tests := []struct {
+		problem Problem
+		text    string
+		answer  int
+	}{
+		{Problem{FirstNum: 12, Operation: "+", SecondNum: 7, Rest: []Link{{"*", 3}, {"-", 5}}}, "12 + 7 * 3 - 5", 28},
+		{Problem{FirstNum: 12, Operation: "+", SecondNum: 7, Rest: []Link{{"*", 3}, {"-", 5}}, Sequential: true}, "((12 + 7) * 3) - 5", 52},
+		{Problem{FirstNum: 20, Operation: "-", SecondNum: 12, Rest: []Link{{"/", 4}, {"*", 2}}}, "20 - 12 / 4 * 2", 14},
+		{Problem{FirstNum: 2, Operation: "*", SecondNum: 3, Rest: []Link{{"-", 4}}, Sequential: true}, "(2 * 3) - 4", 2},
+	}
+	for _, test := range tests {
+		if test.problem.String() != test.text {
+			t.Errorf("Wrong rendering: wanted %q, got %q", test.text, test.problem.String())
+		}
+		parsed, err := ParseProblem(test.text)
+		if err != nil || !reflect.DeepEqual(parsed, test.problem) {
+			t.Errorf("Couldn't parse %q: got %#v (%v)", test.text, parsed, err)
+		}
+		if ans, err := test.problem.Answer(); err != nil || ans != test.answer {
+			t.Errorf("Wrong answer to %s: wanted %d, got %d (%v)", test.text, test.answer, ans, err)
+		}
+		if test.problem.Kind() != OpChain {
+			t.Errorf("Chain %s has kind %s", test.text, test.problem.Kind())
+		}
+	}
+
+	overflow := Problem{FirstNum: 1, Operation: "+", SecondNum: math.MaxInt / 2, Rest: []Link{{"*", 3}}}
+	if _, err := overflow.Answer(); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Overflowing chain gave %v", err)
+	}
+
+	log := NewLog([]Problem{tests[1].problem, {FirstNum: 7, Operation: "*", SecondNum: 8}}, []int64{4000}, 60)
+	parsedLog, err := ParseLog(log.String())
+	if err != nil || !reflect.DeepEqual(parsedLog.Problems, log.Problems) {
+		t.Errorf("Chain didn't survive the log: %v (%v)", parsedLog.Problems, err)
+	}
+	byOperation := SolveTimesByOperation([]Log{log})
+	if !reflect.DeepEqual(byOperation[OpChain], []int64{4000}) || len(byOperation["+"]) != 0 {
+		t.Errorf("Chain solve times grouped wrongly: %v", byOperation)
+	}
+}
+
+func TestGenerateChains(t *testing.T) {
+	for _, sequential := range []bool{false, true} {
+		config := GetZetamacConfig()
+		config.LegalOperations = []string{OpChain}
+		config.setSettings(OpChain, ChainConfig{4, []string{"+", "-", "*", "/"}, sequential, 2, 12, 0, 100})
+		if err := validateConfig(&config); err != nil {
+			t.Fatalf("Chain config rejected: %v", err)
+		}
+		rng := newRand(5)
+		for i := 0; i < 500; i++ {
+			problem := genProblem(rng, config)
+			if len(problem.links()) != 4 || problem.Sequential != sequential {
+				t.Fatalf("Wrong shape of chain %s", problem)
+			}
+			for _, link := range problem.links() {
+				if link.Num < 2 || link.Num > 12 {
+					t.Errorf("Operand out of range in %s", problem)
+				}
+			}
+			ans, err := problem.Answer()
+			if err != nil || ans < 0 || ans > 100 {
+				t.Errorf("Answer to %s out of range: %d (%v)", problem, ans, err)
+			}
+			parsed, err := ParseProblem(problem.String())
+			if err != nil || !reflect.DeepEqual(parsed, problem) {
+				t.Errorf("Generated chain %s doesn't round trip", problem)
+			}
+		}
+	}
+}
+
+func TestValidateChains(t *testing.T) {
+	config := GetZetamacConfig()
+	config.LegalOperations = []string{OpChain}
+	config.setSettings(OpChain, ChainConfig{3, []string{"+"}, false, 2, 5, 100, 200})
+	if err := validateConfig(&config); err == nil {
+		t.Errorf("Chain config with unreachable answers was accepted")
+	}
+	config.setSettings(OpChain, ChainConfig{2, []string{"+", "^"}, false, 2, 5, 0, 20})
+	if err := validateConfig(&config); err == nil {
+		t.Errorf("Chain config with a short length and unknown operation was accepted")
+	}
+}
+
+func TestOperationRegistry(t *testing.T) {
+	config := GetZetamacConfig()
+	config.LegalOperations = operationNames()
+	if err := validateConfig(&config); err != nil {
+		t.Fatalf("Default settings for every operation rejected: %v", err)
+	}
+	rng := newRand(21)
+	seen := map[string]bool{}
+	for _, op := range operations {
+		if seen[op.Name()] {
+			t.Errorf("Operation %q registered twice", op.Name())
+		}
+		seen[op.Name()] = true
+		if lookupOperation(op.Name()) != op {
+			t.Errorf("Looking up %q didn't find it", op.Name())
+		}
+		if reflect.ValueOf(op.Settings(config)).IsZero() {
+			t.Errorf("Operation %q has no default settings", op.Name())
+		}
+		for i := 0; i < 50; i++ {
+			problem := op.Generate(rng, config)
+			if problem.Kind() != op.Name() {
+				t.Errorf("Operation %q generated %s", op.Name(), problem)
+			}
+			if _, err := problem.Answer(); err != nil {
+				t.Errorf("Operation %q generated unanswerable problem %s: %v", op.Name(), problem, err)
+			}
+			parsed, err := ParseProblem(problem.String())
+			if err != nil || !reflect.DeepEqual(parsed, problem) {
+				t.Errorf("Problem %s from %q parsed back as %+v, %v", problem, op.Name(), parsed, err)
+			}
+		}
+	}
+	if lookupOperation("?") != nil {
+		t.Errorf("Looked up an unknown operation")
+	}
+}
+
+func TestOperationSettings(t *testing.T) {
+	config := GetZetamacConfig()
+	copied := config
+	copied.setSettings(OpSquare, SquareConfig{5, 9})
+	if settingsFor[SquareConfig](config, OpSquare) != (SquareConfig{2, 30}) {
+		t.Errorf("Changing a copy's settings changed the original")
+	}
+
+	var loaded Config
+	err := json.Unmarshal([]byte(`{"Settings":{"sq":{"Min":5,"Max":9},"chain":{"Length":4}}}`), &loaded)
+	if err != nil {
+		t.Fatalf("Couldn't decode operation settings: %v", err)
+	}
+	if settingsFor[SquareConfig](loaded, OpSquare) != (SquareConfig{5, 9}) || settingsFor[ChainConfig](loaded, OpChain).Length != 4 {
+		t.Errorf("Decoded wrong operation settings: %v", loaded.Settings)
+	}
+	//settings present already are overridden field by field
+	err = json.Unmarshal([]byte(`{"Settings":{"sq":{"Max":12}}}`), &loaded)
+	if err != nil || settingsFor[SquareConfig](loaded, OpSquare) != (SquareConfig{5, 12}) {
+		t.Errorf("Overlaid wrong square settings: %v (%v)", loaded.Settings, err)
+	}
+	for _, bad := range []string{`{"Settings":{"?":{}}}`, `{"Settings":{"+":{}}}`, `{"Settings":{"sq":{"Min":"five"}}}`} {
+		if err := json.Unmarshal([]byte(bad), &loaded); err == nil {
+			t.Errorf("Decoded bad operation settings %s", bad)
+		}
+	}
+
+	res, err := json.Marshal(copied)
+	if err != nil {
+		t.Fatalf("Couldn't encode config: %v", err)
+	}
+	var roundTrip Config
+	err = json.Unmarshal(res, &roundTrip)
+	if err != nil || !reflect.DeepEqual(roundTrip, copied) {
+		t.Errorf("Config didn't round trip through JSON: %v", err)
+	}
+}
+
+func TestWeightedOperations(t *testing.T) {
+	config := GetZetamacConfig()
+	config.LegalOperations = []string{"+", "*", "-"}
+	config.Weights = map[string]int{"*": 3, "-": 0}
+	if err := validateConfig(&config); err != nil {
+		t.Fatalf("Weighted config rejected: %v", err)
+	}
+	rng := newRand(5)
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		counts[genProblem(rng, config).Operation]++
+	}
+	if counts["-"] != 0 {
+		t.Errorf("Generated %d problems for an operation weighted zero", counts["-"])
+	}
+	if ratio := float64(counts["*"]) / float64(counts["+"]); ratio < 2.6 || ratio > 3.4 {
+		t.Errorf("Wanted about 3 multiplications per addition, got %v", counts)
+	}
+
+	//default weights pick exactly as the uniform choice did
+	unweighted := GetZetamacConfig()
+	rng = newRand(9)
+	uniform := newRand(9)
+	for i := 0; i < 100; i++ {
+		want := unweighted.LegalOperations[randRange(uniform, 0, len(unweighted.LegalOperations)-1)]
+		if got := unweighted.pickOperation(rng); got != want {
+			t.Fatalf("Default weights changed the pick: wanted %s, got %s", want, got)
+		}
+	}
+}
+
+func TestValidateWeights(t *testing.T) {
+	for _, weights := range []map[string]int{
+		{"+": -1},
+		{"+": maxWeight + 1},
+		{"?": 2},
+		{"+": 0, "-": 0, "/": 0, "*": 0},
+	} {
+		config := GetZetamacConfig()
+		config.Weights = weights
+		if validateConfig(&config) == nil {
+			t.Errorf("Accepted weights %v", weights)
+		}
+	}
+}
+
+func TestFingerprintIgnoresIneffectiveWeights(t *testing.T) {
+	config := GetZetamacConfig()
+	changed := GetZetamacConfig()
+	changed.Weights = map[string]int{"+": defaultWeight, OpPower: 4}
+	if config.Fingerprint() != changed.Fingerprint() {
+		t.Errorf("Fingerprint depends on default weights or weights of disabled operations")
+	}
+	changed.Weights["*"] = 2
+	if config.Fingerprint() == changed.Fingerprint() {
+		t.Errorf("Fingerprint ignores weights")
+	}
+}
+
+func TestBalancedWeights(t *testing.T) {
+	logs := []Log{
+		NewLog([]Problem{{FirstNum: 7, Operation: "*", SecondNum: 8}, {FirstNum: 12, Operation: "+", SecondNum: 30}, {FirstNum: 6, Operation: "*", SecondNum: 6}}, []int64{4000, 1000, 2000}, 120),
+	}
+	config := GetZetamacConfig()
+	config.LegalOperations = []string{"+", "*", "-"}
+	want := map[string]int{"+": balanceScale / 1000, "*": balanceScale / 3000, "-": balanceScale / 2333}
+	if got := BalancedWeights(logs, config); !reflect.DeepEqual(want, got) {
+		t.Errorf("Wrong balanced weights: wanted %v, got %v", want, got)
+	}
+
+	config.BalanceOperations = true
+	if got := balanceOperations(config, logs).Weights; !reflect.DeepEqual(want, got) {
+		t.Errorf("History not used for balancing: wanted %v, got %v", want, got)
+	}
+	if got := balanceOperations(config, nil).Weights; got != nil {
+		t.Errorf("Balanced without history: %v", got)
+	}
+
+	//the recorded weights replay a balanced game without the history
+	config.Seed = 9
+	source := newProblemSource(config, logs)
+	recorded := source.(weightedSource).Weights()
+	if !reflect.DeepEqual(want, recorded) {
+		t.Errorf("Wrong weights recorded: wanted %v, got %v", want, recorded)
+	}
+	replay := config
+	replay.BalanceOperations = false
+	replay.Weights = recorded
+	replayed := newProblemSource(replay, nil)
+	if got := replayed.(weightedSource).Weights(); got != nil {
+		t.Errorf("Unbalanced game recorded weights: %v", got)
+	}
+	for i := 0; i < 100; i++ {
+		if problem, again := source.Next(), replayed.Next(); !reflect.DeepEqual(problem, again) {
+			t.Fatalf("Replay diverged at problem %d: %s vs %s", i, problem, again)
+		}
+	}
+}
+
+func TestCleanDivisionsMatchBruteForce(t *testing.T) {
+	for _, config := range []DivisionConfig{
+		{2, 1200, 2, 100, true, "", 0},
+		{37, 61, 5, 9, true, "", 0},
+		{1, 1, 1, 1, true, "", 0},
+		{50, 60, 100, 200, true, "", 0},
+	} {
+		want := 0
+		for a := config.MinLeft; a <= config.MaxLeft; a++ {
+			for b := config.MinRight; b <= config.MaxRight; b++ {
+				if a%b == 0 {
+					want++
+				}
+			}
+		}
+		if got := config.cleanDivisions(); got != want {
+			t.Errorf("Wrong clean division count for %s: wanted %d, got %d", config, want, got)
+		}
+	}
+}
+
+func TestGenerateSparseOperands(t *testing.T) {
+	//the only clean division is a large prime by itself
+	div := DivisionConfig{99_999_989, 99_999_989, 2, 99_999_989, true, "", 0}
+	sub := SubtractionConfig{0, 10, 10, 1_000_000_000, true}
+	rng := newRand(3)
+	for i := 0; i < 100; i++ {
+		if problem := genDivisionProblem(rng, div); problem.FirstNum != 99_999_989 || problem.SecondNum != 99_999_989 {
+			t.Fatalf("Generated %s outside the only clean division", problem)
+		}
+		if problem := genSubtractionProblem(rng, sub); problem.FirstNum != 10 || problem.SecondNum != 10 {
+			t.Fatalf("Generated %s outside the only non-negative difference", problem)
+		}
+	}
+}
+
+func TestGenerateConstrainedUniformly(t *testing.T) {
+	rng := newRand(8)
+	const draws = 60000
+	div := DivisionConfig{12, 40, 2, 9, true, "", 0}
+	sub := SubtractionConfig{3, 12, 5, 15, true}
+	divCounts := map[[2]int]int{}
+	subCounts := map[[2]int]int{}
+	for i := 0; i < draws; i++ {
+		problem := genDivisionProblem(rng, div)
+		divCounts[[2]int{problem.FirstNum, problem.SecondNum}]++
+		problem = genSubtractionProblem(rng, sub)
+		subCounts[[2]int{problem.FirstNum, problem.SecondNum}]++
+	}
+	check := func(name string, counts map[[2]int]int, valid func(a, b int) bool, minLeft, maxLeft, minRight, maxRight int) {
+		pairs := 0
+		for a := minLeft; a <= maxLeft; a++ {
+			for b := minRight; b <= maxRight; b++ {
+				if valid(a, b) {
+					pairs++
+				}
+			}
+		}
+		if len(counts) != pairs {
+			t.Errorf("Generated %d distinct %s pairs, wanted %d", len(counts), name, pairs)
+		}
+		expected := float64(draws) / float64(pairs)
+		for pair, count := range counts {
+			if !valid(pair[0], pair[1]) || pair[0] < minLeft || pair[0] > maxLeft || pair[1] < minRight || pair[1] > maxRight {
+				t.Errorf("Generated invalid %s pair %v", name, pair)
+			}
+			if math.Abs(float64(count)-expected) > 0.25*expected {
+				t.Errorf("%s pair %v drawn %d times, expected about %.0f", name, pair, count, expected)
+			}
+		}
+	}
+	check("division", divCounts, func(a, b int) bool { return a%b == 0 }, div.MinLeft, div.MaxLeft, div.MinRight, div.MaxRight)
+	check("subtraction", subCounts, func(a, b int) bool { return a >= b }, sub.MinLeft, sub.MaxLeft, sub.MinRight, sub.MaxRight)
+}
+
+func TestValidateDivisionAnswerLength(t *testing.T) {
+	config := GetZetamacConfig()
+	for _, div := range []DivisionConfig{
+		//99999 / 7 to six places is 14285.571429
+		{2, 100000, 3, 7, false, DivisionDecimal, 6},
+		{2, 99999, 2, 99999, false, DivisionRemainder, 0},
+		{1, 99_999_999_999, 1, 10, false, DivisionInteger, 0},
+	} {
+		config.DivisionConfig = div
+		if validateConfig(&config) == nil {
+			t.Errorf("Accepted division config %s with answers too long to type", div)
+		}
+	}
+
+	config.DivisionConfig = DivisionConfig{2, 9999, 3, 7, false, DivisionDecimal, 4}
+	if err := validateConfig(&config); err != nil {
+		t.Fatalf("Rejected division config with short enough answers: %v", err)
+	}
+	for a := config.DivisionConfig.MinLeft; a <= config.DivisionConfig.MaxLeft; a++ {
+		for b := config.DivisionConfig.MinRight; b <= config.DivisionConfig.MaxRight; b++ {
+			answer, err := config.ExpectedAnswer(Problem{FirstNum: a, Operation: "/", SecondNum: b})
+			if err != nil || len(answer) > maxAnswerLength {
+				t.Fatalf("Answer to %d / %d can't be typed: %q (%v)", a, b, answer, err)
+			}
+		}
+	}
+}
+
+func TestValidateCleanDivision(t *testing.T) {
+	config := GetZetamacConfig()
+	//no number from 101 to 103 has a divisor from 52 to 100
+	config.DivisionConfig = DivisionConfig{101, 103, 52, 100, true, "", 0}
+	if validateConfig(&config) == nil {
+		t.Errorf("Accepted division config without clean divisions")
+	}
+	config.DivisionConfig.ForceCleanDivision = false
+	if err := validateConfig(&config); err != nil {
+		t.Errorf("Rejected division config that needs no clean divisions: %v", err)
+	}
+	config.DivisionConfig = DivisionConfig{2, maxCleanDividend + 1, 2, 100, true, "", 0}
+	if validateConfig(&config) == nil {
+		t.Errorf("Accepted clean division dividends past %d", maxCleanDividend)
+	}
+}
+
+func TestFactsCoverGeneration(t *testing.T) {
+	config := GetZetamacConfig()
+	config.OverrideDivisionConfig = false
+	rng := newRand(13)
+	for _, op := range operations {
+		facts, ok := op.Facts(config, maxDeckSize)
+		if op.Name() == OpChain {
+			if ok {
+				t.Errorf("Listed chains as facts")
+			}
+			continue
+		}
+		if !ok || len(facts) == 0 {
+			t.Errorf("Couldn't list the facts of %q", op.Name())
+			continue
+		}
+		listed := map[string]bool{}
+		for _, fact := range facts {
+			listed[fact.String()] = true
+		}
+		if len(listed) != len(facts) {
+			t.Errorf("Listed facts of %q more than once", op.Name())
+		}
+		for i := 0; i < 200; i++ {
+			if problem := op.Generate(rng, config); !listed[problem.String()] {
+				t.Errorf("Generated %s, which isn't among the facts of %q", problem, op.Name())
+			}
+		}
+		if _, ok := op.Facts(config, len(facts)-1); ok {
+			t.Errorf("Listed more facts of %q than the limit", op.Name())
+		}
+	}
+}
+
+func TestNoRepeatWindow(t *testing.T) {
+	config := GetZetamacConfig()
+	config.LegalOperations = []string{"*"}
+	config.MultiplicationConfig = MultiplicationConfig{2, 4, 2, 4}
+	config.NoRepeatWindow = 3
+	config.SuppressCommutative = true
+	if err := validateConfig(&config); err != nil {
+		t.Fatalf("Repeat window rejected: %v", err)
+	}
+	source := newProblemSource(config, nil)
+	var recent []string
+	for i := 0; i < 300; i++ {
+		problem := source.Next()
+		fact := fmt.Sprint(min(problem.FirstNum, problem.SecondNum), max(problem.FirstNum, problem.SecondNum))
+		if slices.Contains(recent, fact) {
+			t.Fatalf("Problem %d, %s, repeats a fact from the last %d: %v", i, problem, config.NoRepeatWindow, recent)
+		}
+		recent = append(recent, fact)
+		if len(recent) > config.NoRepeatWindow {
+			recent = recent[1:]
+		}
+	}
+}
+
+func TestDeckMode(t *testing.T) {
+	config := GetZetamacConfig()
+	config.LegalOperations = []string{"*", "+"}
+	config.MultiplicationConfig = MultiplicationConfig{2, 4, 2, 4}
+	config.AdditionConfig = AdditionConfig{1, 2, 1, 2}
+	config.Weights = map[string]int{"*": 9, "+": 0}
+	config.DeckMode = true
+	if err := validateConfig(&config); err != nil {
+		t.Fatalf("Deck mode rejected: %v", err)
+	}
+	source := newProblemSource(config, nil)
+	for deal := 0; deal < 3; deal++ {
+		seen := map[string]bool{}
+		for i := 0; i < 9; i++ {
+			seen[source.Next().String()] = true
+		}
+		if len(seen) != 9 {
+			t.Errorf("Deal %d didn't cover all 9 facts once: %v", deal, seen)
+		}
+	}
+
+	config.SuppressCommutative = true
+	source = newProblemSource(config, nil)
+	seen := map[string]bool{}
+	for i := 0; i < 6; i++ {
+		problem := source.Next()
+		seen[fmt.Sprint(min(problem.FirstNum, problem.SecondNum), max(problem.FirstNum, problem.SecondNum))] = true
+	}
+	if len(seen) != 6 {
+		t.Errorf("Deck with commutative duplicates suppressed didn't cover all 6 facts once: %v", seen)
+	}
+}
+
+func TestValidatePolicies(t *testing.T) {
+	for name, change := range map[string]func(*Config){
+		"negative window": func(config *Config) { config.NoRepeatWindow = -1 },
+		"huge window":     func(config *Config) { config.NoRepeatWindow = maxRepeatWindow + 1 },
+		"adaptive deck":   func(config *Config) { config.DeckMode, config.Adaptive = true, true },
+		"chain deck": func(config *Config) {
+			config.DeckMode = true
+			config.LegalOperations = append(config.LegalOperations, OpChain)
+		},
+		"huge deck": func(config *Config) {
+			config.DeckMode = true
+			config.AdditionConfig = AdditionConfig{1, 1000, 1, 1000}
+		},
+	} {
+		config := GetZetamacConfig()
+		change(&config)
+		if validateConfig(&config) == nil {
+			t.Errorf("Accepted config with %s", name)
+		}
+	}
+}
+
+func TestPresets(t *testing.T) {
+	seen := map[string]bool{}
+	for _, preset := range presets {
+		config, ok := lookupPreset(preset.name)
+		if !ok || config.Name != preset.name || seen[preset.name] {
+			t.Errorf("Preset %q not found by name, misnamed or listed twice", preset.name)
+		}
+		seen[preset.name] = true
+		if err := validateConfig(&config); err != nil {
+			t.Errorf("Preset %q is invalid: %v", preset.name, err)
+		}
+	}
+	if _, ok := lookupPreset("nonexistent"); ok {
+		t.Errorf("Found a preset that doesn't exist")
+	}
+
+	paths := Paths{ConfigDir: t.TempDir()}
+	config, err := loadNamedConfig(paths, "times-tables")
+	if err != nil || !reflect.DeepEqual(config, timesTablesPreset()) {
+		t.Errorf("Failed loading preset by name: %v %s", err, config.String())
+	}
+	saved := timesTablesPreset()
+	saved.Duration = 45
+	saved.Save(paths.Config("times-tables"))
+	if config, err := loadNamedConfig(paths, "times-tables"); err != nil || config.Duration != 45 {
+		t.Errorf("Saved config didn't take precedence over the preset: %v %s", err, config.String())
+	}
+}
+
+func TestExtendsConfig(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/tables.txt", []byte(`{"extends": "times-tables", "Duration": 60, "MultiplicationConfig": {"MaxLeft": 9}}`), 0644)
+	os.WriteFile(dir+"/short.txt", []byte(`{"Extends": "tables", "Name": "quick", "Duration": 30}`), 0644)
+
+	want := timesTablesPreset()
+	want.Name = "tables"
+	want.Extends = "times-tables"
+	want.Duration = 60
+	want.MultiplicationConfig.MaxLeft = 9
+	var got Config
+	if err := got.Load(dir + "/tables.txt"); err != nil || !reflect.DeepEqual(want, got) {
+		t.Errorf("Failed extending a preset: wanted %s, got %s (%v)", want.String(), got.String(), err)
+	}
+
+	want.Name = "quick"
+	want.Extends = "tables"
+	want.Duration = 30
+	if err := got.Load(dir + "/short.txt"); err != nil || !reflect.DeepEqual(want, got) {
+		t.Errorf("Failed extending a saved config: wanted %s, got %s (%v)", want.String(), got.String(), err)
+	}
+	os.WriteFile(dir+"/hard.txt", []byte(`{"Extends": "hard", "Duration": 60}`), 0644)
+	want = hardPreset()
+	want.Extends = "hard"
+	want.Duration = 60
+	var shadowing Config
+	if err := shadowing.Load(dir + "/hard.txt"); err != nil || !reflect.DeepEqual(want, shadowing) {
+		t.Errorf("Failed extending the preset a saved config shadows: wanted %s, got %s (%v)", want.String(), shadowing.String(), err)
+	}
+
+	if got.Fingerprint() == timesTablesPreset().Fingerprint() {
+		t.Errorf("Overrides don't show in the fingerprint")
+	}
+	same := timesTablesPreset()
+	same.MultiplicationConfig.MaxLeft = 9
+	if got.Fingerprint() != same.Fingerprint() {
+		t.Errorf("Fingerprint depends on where settings were inherited from")
+	}
+}
+
+func TestExtendsErrors(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/a.txt", []byte(`{"Extends": "b"}`), 0644)
+	os.WriteFile(dir+"/b.txt", []byte(`{"Extends": "c"}`), 0644)
+	os.WriteFile(dir+"/c.txt", []byte(`{"Extends": "a"}`), 0644)
+	os.WriteFile(dir+"/self.txt", []byte(`{"Extends": "self"}`), 0644)
+	os.WriteFile(dir+"/typo.txt", []byte(`{"Extends": "zetamcc"}`), 0644)
+	os.WriteFile(dir+"/broken.txt", []byte(`{"Extends": "zetamac", "Duration": "long"}`), 0644)
+
+	var config Config
+	err := config.Load(dir + "/a.txt")
+	if err == nil || !strings.Contains(err.Error(), "a -> b -> c -> a") {
+		t.Errorf("Expected inheritance cycle error, got %v", err)
+	}
+	if err := config.Load(dir + "/self.txt"); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("Expected error for a config extending itself, got %v", err)
+	}
+	if err := config.Load(dir + "/typo.txt"); err == nil || !strings.Contains(err.Error(), "zetamcc") {
+		t.Errorf("Expected unknown config error, got %v", err)
+	}
+	if err := config.Load(dir + "/broken.txt"); err == nil {
+		t.Errorf("Expected error loading malformed config")
+	}
+}
+
+func TestChainsLandInRange(t *testing.T) {
+	for _, settings := range []ChainConfig{
+		{3, []string{"*", "+"}, false, 2, 50, 359, 364},
+		{5, []string{"-", "*", "/"}, false, -9, 9, -3, 3},
+		{4, []string{"+", "-", "*", "/"}, true, 1, 30, 100, 120},
+		{3, []string{"/"}, false, 1, 12, 1, 1},
+	} {
+		config := GetZetamacConfig()
+		config.LegalOperations = []string{OpChain}
+		config.setSettings(OpChain, settings)
+		if err := validateConfig(&config); err != nil {
+			t.Fatalf("Chain config %s rejected: %v", settings, err)
+		}
+		rng := newRand(17)
+		for i := 0; i < 3000; i++ {
+			problem := genChainProblem(rng, settings)
+			for _, link := range problem.links() {
+				if link.Num < settings.MinOperand || link.Num > settings.MaxOperand {
+					t.Fatalf("Operand out of range in %s", problem)
+				}
+			}
+			if ans, err := problem.Answer(); err != nil || ans < settings.MinAnswer || ans > settings.MaxAnswer {
+				t.Fatalf("Answer to %s out of range: %d (%v)", problem, ans, err)
+			}
+		}
+	}
+}
+
+// listSource deals problems in order, repeating the last one.
+type listSource struct {
+	problems []Problem
+}
+
+func (source *listSource) Next() Problem {
+	problem := source.problems[0]
+	if len(source.problems) > 1 {
+		source.problems = source.problems[1:]
+	}
+	return problem
+}
+
+func TestGameEndsOnUnanswerableProblem(t *testing.T) {
+	config := GetZetamacConfig()
+	clock := newFakeClock()
+	input := &scriptedInput{keys: make(chan KeyEvent), clock: clock, start: clock.Now()}
+	source := &listSource{[]Problem{{FirstNum: 3, Operation: "+", SecondNum: 4}, {FirstNum: 3, Operation: "/", SecondNum: 0}}}
+	game := Game{Config: config, Source: source, Input: input, Renderer: &recordingRenderer{}, Clock: clock}
+	type result struct {
+		log Log
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		log, err := game.Run(context.Background())
+		done <- result{log, err}
+	}()
+	input.typeAt("7", time.Second)
+	res := <-done
+
+	if !errors.Is(res.err, ErrDivisionByZero) {
+		t.Errorf("Expected the unanswerable problem to be reported, got %v", res.err)
+	}
+	if len(res.log.Problems) != 1 || res.log.Score() != 1 {
+		t.Errorf("Wrong log after an unanswerable problem: %+v", res.log)
+	}
+}
+
+// timingRecorder is a source that keeps every solve time recorded.
+type timingRecorder struct {
+	ProblemSource
+	times []int64
+}
+
+func (source *timingRecorder) Record(problem Problem, ms int64) error {
+	source.times = append(source.times, ms)
+	return nil
+}
+
+func TestGameRecordsUnansweredProblem(t *testing.T) {
+	config := GetZetamacConfig()
+	clock := newFakeClock()
+	input := &scriptedInput{keys: make(chan KeyEvent), clock: clock, start: clock.Now()}
+	source := &timingRecorder{ProblemSource: &listSource{[]Problem{{FirstNum: 3, Operation: "+", SecondNum: 4}, {FirstNum: 6, Operation: "*", SecondNum: 7}}}}
+	game := Game{Config: config, Source: source, Input: input, Renderer: &recordingRenderer{}, Clock: clock}
+	done := make(chan Log)
+	go func() {
+		log, _ := game.Run(context.Background())
+		done <- log
+	}()
+	input.typeAt("7", time.Second)
+	close(input.keys)
+	<-done
+
+	if !reflect.DeepEqual(source.times, []int64{1000, -1}) {
+		t.Errorf("Expected the unanswered problem recorded as -1, got %v", source.times)
+	}
+	if gradeSolveTime(-1) != 0 {
+		t.Errorf("An unanswered problem should grade as a failed recall")
+	}
+}
+
+// failingRecorder is a source whose results can never be recorded.
+type failingRecorder struct {
+	ProblemSource
+	records int
+}
+
+func (source *failingRecorder) Record(problem Problem, ms int64) error {
+	source.records++
+	return errors.New("disk full")
+}
+
+func TestGameContinuesAfterFailedRecord(t *testing.T) {
+	config := GetZetamacConfig()
+	config.Seed = 3
+	expected := newProblemSource(config, nil)
+	firstAns, secondAns := strconv.Itoa(getProblemAnswer(expected.Next())), strconv.Itoa(getProblemAnswer(expected.Next()))
+
+	clock := newFakeClock()
+	input := &scriptedInput{keys: make(chan KeyEvent), clock: clock, start: clock.Now()}
+	source := &failingRecorder{ProblemSource: newProblemSource(config, nil)}
+	game := Game{Config: config, Source: source, Input: input, Renderer: &recordingRenderer{}, Clock: clock}
+	type result struct {
+		log Log
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		log, err := game.Run(context.Background())
+		done <- result{log, err}
+	}()
+	input.typeAt(firstAns, time.Second)
+	input.typeAt(secondAns, 2*time.Second)
+	close(input.keys)
+	res := <-done
+
+	if res.err == nil || !strings.Contains(res.err.Error(), "disk full") {
+		t.Errorf("Expected the failed record to be reported, got %v", res.err)
+	}
+	//the third record is the problem left unanswered when input ends
+	if source.records != 3 || res.log.Score() != 2 {
+		t.Errorf("Game stopped after a failed record: %d records, score %d", source.records, res.log.Score())
+	}
+}